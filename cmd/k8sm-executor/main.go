@@ -1,13 +1,11 @@
 package main
 
 import (
-	"bufio"
+	"errors"
 	"flag"
 	"io"
 	"math/rand"
 	"net"
-	"os"
-	"os/exec"
 	"strings"
 	"sync"
 	"time"
@@ -20,10 +18,12 @@ import (
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/standalone"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/version/verflag"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/watch"
 	"github.com/fsouza/go-dockerclient"
 	log "github.com/golang/glog"
 	"github.com/mesos/mesos-go/mesos"
 	"github.com/mesosphere/kubernetes-mesos/pkg/executor"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/proxy"
 )
 
 const (
@@ -51,14 +51,30 @@ var (
 	cAdvisorPort            = flag.Uint("cadvisor_port", 4194, "The port of the localhost cAdvisor endpoint")
 	oomScoreAdj             = flag.Int("oom_score_adj", -900, "The oom_score_adj value for kubelet process. Values must be within the range [-1000, 1000]")
 	apiServerList           util.StringList
+	allowedHostPaths        util.StringList
 	clusterDomain           = flag.String("cluster_domain", "", "Domain for this cluster.  If set, kubelet will configure all containers to search this domain in addition to the host's search domains")
 	clusterDNS              = util.IP(nil)
+	usageReportInterval     = flag.Duration("usage_report_interval", 30*time.Second, "Period between reports of pod resource usage to the scheduler; 0 disables reporting.")
+	runProxy                = flag.Bool("run_proxy", true, "Maintain a running kube-proxy instance as a child proc of this kubelet-executor. Disable for clusters that run their own service proxy.")
+	proxyMode               = flag.String("proxy_mode", "process", "How to run the service proxy: 'process' runs kube-proxy as a supervised child process, 'inprocess' runs the proxy within the executor.")
+	proxyExec               = flag.String("proxy_exec", "", "Path to the kube-proxy executable. Defaults to the kube-proxy fetched into the mesos sandbox, or found in the PATH.")
+	proxyLogfile            = flag.String("proxy_logfile", "./proxy-log", "Path to the kube-proxy log file.")
+	proxyLogMaxSize         = flag.Int("proxy_logfile_maxsize", 100, "Maximum size, in MB, of the kube-proxy log file before it is rotated; 0 disables rotation.")
+	proxyLogBackups         = flag.Int("proxy_logfile_backups", 5, "Number of rotated kube-proxy log files to keep.")
+	tlsCertFile             = flag.String("tls_cert_file", "", "File containing the x509 certificate for the info server. If set, the info server only serves HTTPS.")
+	tlsPrivateKeyFile       = flag.String("tls_private_key_file", "", "File containing the x509 private key matching -tls_cert_file.")
+	clientCAFile            = flag.String("client_ca_file", "", "If set, clients of the info server may authenticate with a certificate signed by one of the authorities in this file. Requires -tls_cert_file.")
+	tokenAuthFile           = flag.String("token_auth_file", "", "If set, clients of the info server may authenticate with a bearer token listed in this file (lines of token,user). Requires -tls_cert_file.")
+	adminUsers              util.StringList
+	recoveryTimeout         = flag.Duration("recovery_timeout", executor.DefaultRecoveryTimeout, "Amount of time the executor keeps pods running after losing its connection to the slave. Pods are shut down if the slave does not reconnect within this window; 0 waits forever.")
 )
 
 func init() {
 	flag.Var(&etcdServerList, "etcd_servers", "List of etcd servers to watch (http://ip:port), comma separated")
 	flag.Var(&address, "address", "The IP address for the info and proxy servers to serve on. Default to 0.0.0.0.")
 	flag.Var(&apiServerList, "api_servers", "List of Kubernetes API servers to publish events to. (ip:port), comma separated.")
+	flag.Var(&allowedHostPaths, "allowed_host_paths", "Host directories that pods may mount as volumes, comma separated. Subdirectories are also allowed. Empty allows any host path.")
+	flag.Var(&adminUsers, "admin_users", "Authenticated users allowed to use the debugging endpoints of the info server, comma separated. Only applies if -client_ca_file or -token_auth_file is set.")
 	flag.Var(&clusterDNS, "cluster_dns", "IP address for a cluster DNS server.  If set, kubelet will configure all containers to use this for DNS resolution in addition to the host's DNS servers")
 }
 
@@ -129,7 +145,19 @@ func main() {
 			driver:      driver,
 			initialized: initialized,
 		}
-		driver.Executor = executor.New(driver, k.Kubelet, updates, MESOS_CFG_SOURCE)
+		kexecutor := executor.New(driver, executor.Config{
+			Kubelet:          k.Kubelet,
+			Updates:          updates,
+			SourceName:       MESOS_CFG_SOURCE,
+			RecoveryTimeout:  *recoveryTimeout,
+			AllowPrivileged:  *allowPrivileged,
+			AllowedHostPaths: allowedHostPaths,
+		})
+		driver.Executor = kexecutor
+		k.executor = kexecutor
+		if client, ok := kc.DockerClient.(*docker.Client); ok {
+			k.streamer = executor.NewDockerStreamer(client)
+		}
 
 		log.V(2).Infof("Initialize executor driver...")
 		driver.Init()
@@ -138,7 +166,10 @@ func main() {
 		k.reconcileTasks(kc.DockerClient)
 
 		go k.GarbageCollectLoop()
-		// go k.MonitorCAdvisor(kc.CAdvisorPort) // TODO(jdef) support cadvisor at some point
+		go kubelet.MonitorCAdvisor(k.Kubelet, kc.CAdvisorPort)
+		if *usageReportInterval > 0 {
+			go util.Forever(kexecutor.ReportUsage, *usageReportInterval)
+		}
 
 		k.InitHealthChecking()
 		return k, pc
@@ -155,11 +186,16 @@ func main() {
 	driver.Join()
 }
 
+var errStreamingUnsupported = errors.New("docker client does not support streaming")
+
 type kubeletExecutor struct {
 	*kubelet.Kubelet
 	driver      *mesos.MesosExecutorDriver
 	initialize  sync.Once
 	initialized chan struct{}
+	proxy       proxy.Service
+	executor    *executor.KubernetesExecutor
+	streamer    *executor.DockerStreamer // nil if the docker client doesn't support streaming
 }
 
 func (kl *kubeletExecutor) reconcileTasks(dockerClient dockertools.DockerInterface) {
@@ -186,7 +222,9 @@ func (kl *kubeletExecutor) ListenAndServe(address net.IP, port uint, enableDebug
 	// so only execute certain initialization procs once
 	kl.initialize.Do(func() {
 		defer close(kl.initialized)
-		go util.Forever(runProxyService, 5*time.Second)
+		if *runProxy {
+			kl.runProxyService()
+		}
 		kl.driver.Start()
 		log.V(2).Infof("Executor driver is running!")
 
@@ -194,16 +232,95 @@ func (kl *kubeletExecutor) ListenAndServe(address net.IP, port uint, enableDebug
 		// @see reconcileTasks
 	})
 	log.Infof("Starting kubelet server...")
-	log.Error(executor.ListenAndServeKubeletServer(kl, address, port, enableDebuggingHandlers, MESOS_CFG_SOURCE))
+	auth := executor.AuthConfig{
+		TLSCertFile:  *tlsCertFile,
+		TLSKeyFile:   *tlsPrivateKeyFile,
+		ClientCAFile: *clientCAFile,
+		TokenFile:    *tokenAuthFile,
+		AdminUsers:   adminUsers,
+	}
+	log.Error(executor.ListenAndServeKubeletServer(kl, address, port, enableDebuggingHandlers, MESOS_CFG_SOURCE, auth))
+}
+
+// implements executor.Drainer
+func (kl *kubeletExecutor) Drain() {
+	kl.executor.Drain()
+}
+
+// implements executor.Drainer
+func (kl *kubeletExecutor) Undrain() {
+	kl.executor.Undrain()
+}
+
+// implements executor.ContainerStreamer
+func (kl *kubeletExecutor) ExecInContainer(podFullName, uuid, container string, cmd []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
+	if kl.streamer == nil {
+		return errStreamingUnsupported
+	}
+	return kl.streamer.ExecInContainer(podFullName, uuid, container, cmd, stdin, stdout, stderr, tty)
+}
+
+// implements executor.ContainerStreamer
+func (kl *kubeletExecutor) AttachContainer(podFullName, uuid, container string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
+	if kl.streamer == nil {
+		return errStreamingUnsupported
+	}
+	return kl.streamer.AttachContainer(podFullName, uuid, container, stdin, stdout, stderr, tty)
+}
+
+// implements executor.ContainerStreamer
+func (kl *kubeletExecutor) PortForward(podFullName, uuid string, port uint16, stream io.ReadWriteCloser) error {
+	if kl.streamer == nil {
+		stream.Close()
+		return errStreamingUnsupported
+	}
+	return kl.streamer.PortForward(podFullName, uuid, port, stream)
+}
+
+// implements executor.BoundPodWatcher
+func (kl *kubeletExecutor) WatchBoundPods() watch.Interface {
+	return kl.executor.WatchBoundPods()
+}
+
+// implements executor.ServiceProxyHost
+func (kl *kubeletExecutor) ServiceProxyStatus() interface{} {
+	if kl.proxy == nil {
+		return nil
+	}
+	return kl.proxy.Status()
+}
+
+// start the proxy service in the configured mode. failure to set up the proxy is
+// logged but is not fatal to the executor.
+func (kl *kubeletExecutor) runProxyService() {
+	switch *proxyMode {
+	case "process":
+		kl.proxy = newProxySupervisor()
+	case "inprocess":
+		kl.proxy = proxy.NewInProcess(proxy.InProcessConfig{
+			BindAddress:    net.IP(address),
+			EtcdServers:    etcdServerList,
+			EtcdConfigFile: *etcdConfigFile,
+		})
+	default:
+		log.Errorf("Unknown proxy mode %q, proxy service will not run", *proxyMode)
+	}
+	if kl.proxy != nil {
+		go kl.proxy.Run(nil)
+	}
 }
 
-// this function blocks as long as the proxy service is running; intended to be
-// executed asynchronously.
-func runProxyService() {
+// create a supervisor that keeps a kube-proxy child process running, or nil if
+// the proxy executable cannot be found.
+func newProxySupervisor() proxy.Service {
 	// TODO(jdef): would be nice if we could run the proxy via an in-memory
 	// kubelet config source (in case it crashes, kubelet would restart it);
 	// not sure that k8s supports host-networking space for pods
-	log.Infof("Starting proxy process...")
+	path, err := proxy.FindExec(*proxyExec)
+	if err != nil {
+		log.Errorf("Failed to locate the proxy executable, proxy service will not run: %v", err)
+		return nil
+	}
 
 	args := []string{"-bind_address=" + address.String(), "-logtostderr=true", "-v=1"}
 	if len(etcdServerList) > 0 {
@@ -212,30 +329,11 @@ func runProxyService() {
 	} else if *etcdConfigFile != "" {
 		args = append(args, "-etcd_config="+*etcdConfigFile)
 	}
-	//TODO(jdef): don't hardcode name of the proxy executable here
-	cmd := exec.Command("./kube-proxy", args...)
-	_, err := cmd.StdoutPipe()
-	if err != nil {
-		log.Fatal(err)
-	}
-	proxylogs, err := cmd.StderrPipe()
-	if err != nil {
-		log.Fatal(err)
-	}
-	logfile, err := os.Create("./proxy-log")
-	if err != nil {
-		log.Fatal(err)
-	}
-	defer logfile.Close()
-	writer := bufio.NewWriter(logfile)
-	defer writer.Flush()
-
-	if err := cmd.Start(); err != nil {
-		log.Fatal(err)
-	}
-	defer func() {
-		log.V(2).Infof("Cleaning up proxy process...")
-		cmd.Process.Kill()
-	}()
-	io.Copy(writer, proxylogs)
+	return proxy.NewSupervisor(proxy.Config{
+		Exec:        path,
+		Args:        args,
+		LogFile:     *proxyLogfile,
+		LogMaxBytes: int64(*proxyLogMaxSize) * 1024 * 1024,
+		LogBackups:  *proxyLogBackups,
+	})
 }
@@ -61,12 +61,11 @@ var (
 	authPath        = flag.String("auth_path", "", "Path to .kubernetes_auth file, specifying how to authenticate to API server.")
 	apiServerList   util.StringList
 
-	executorPath        = flag.String("executor_path", "", "Location of the kubernetes executor executable")
-	proxyPath           = flag.String("proxy_path", "", "Location of the kubernetes proxy executable")
-	mesosUser           = flag.String("mesos_user", "", "Mesos user for this framework, defaults to the username that owns the framework process.")
-	mesosRole           = flag.String("mesos_role", "", "Mesos role for this framework, defaults to none.")
-	mesosAuthPrincipal  = flag.String("mesos_authentication_principal", "", "Mesos authentication principal.")
-	mesosAuthSecretFile = flag.String("mesos_authentication_secret_file", "", "Mesos authentication secret file.")
+	executorPath = flag.String("executor_path", "", "Location of the kubernetes executor executable")
+	proxyPath    = flag.String("proxy_path", "", "Location of the kubernetes proxy executable. If empty, executors do not run a service proxy unless -proxy_mode=inprocess.")
+	proxyMode    = flag.String("proxy_mode", "process", "How executors run the service proxy: 'process' fetches and runs the -proxy_path executable, 'inprocess' runs the proxy within the executor.")
+	mesosUser    = flag.String("mesos_user", "", "Mesos user for this framework, defaults to the username that owns the framework process.")
+	mesosRole    = flag.String("mesos_role", "", "Mesos role for this framework, defaults to none.")
 )
 
 func init() {
@@ -101,8 +100,6 @@ func serveExecutorArtifact(path string) (*string, string) {
 
 func prepareExecutorInfo() *mesos.ExecutorInfo {
 	executorUris := []*mesos.CommandInfo_URI{}
-	uri, _ := serveExecutorArtifact(*proxyPath)
-	executorUris = append(executorUris, &mesos.CommandInfo_URI{Value: uri, Executable: proto.Bool(true)})
 	uri, executorCmd := serveExecutorArtifact(*executorPath)
 	executorUris = append(executorUris, &mesos.CommandInfo_URI{Value: uri, Executable: proto.Bool(true)})
 
@@ -110,6 +107,16 @@ func prepareExecutorInfo() *mesos.ExecutorInfo {
 	//TODO(jdef): set -hostname_override and -address to 127.0.0.1 if `address` is 127.0.0.1
 	apiServerArgs := strings.Join(apiServerList, ",")
 	executorCommand := fmt.Sprintf("./%s -v=2 -hostname_override=0.0.0.0 -allow_privileged=%t -api_servers=%s", executorCmd, *allowPrivileged, apiServerArgs)
+
+	if *proxyMode == "inprocess" {
+		executorCommand = fmt.Sprintf("%s -proxy_mode=inprocess", executorCommand)
+	} else if *proxyPath != "" {
+		uri, proxyCmd := serveExecutorArtifact(*proxyPath)
+		executorUris = append(executorUris, &mesos.CommandInfo_URI{Value: uri, Executable: proto.Bool(true)})
+		executorCommand = fmt.Sprintf("%s -proxy_exec=./%s", executorCommand, proxyCmd)
+	} else {
+		executorCommand = fmt.Sprintf("%s -run_proxy=false", executorCommand)
+	}
 	if len(etcdServerList) > 0 {
 		etcdServerArguments := strings.Join(etcdServerList, ",")
 		executorCommand = fmt.Sprintf("%s -etcd_servers=%s", executorCommand, etcdServerArguments)
@@ -225,6 +232,9 @@ func main() {
 	log.V(1).Info("Clearing old pods from the registry")
 	clearOldPods(client)
 
+	http.Handle("/usage", mesosPodScheduler.UsageHandler())
+	http.Handle("/drain", mesosPodScheduler.DrainHandler())
+	http.Handle("/undrain", mesosPodScheduler.UndrainHandler())
 	go util.Forever(func() {
 		log.V(1).Info("Starting HTTP interface")
 		log.Error(http.ListenAndServe(net.JoinHostPort(address.String(), strconv.Itoa(*port)), nil))
@@ -244,20 +254,20 @@ func buildFrameworkInfo() (info *mesos.FrameworkInfo, cred *mesos.Credential, er
 	}
 	log.V(2).Infof("Framework configured with mesos user %v", username)
 	info = &mesos.FrameworkInfo{
-		Name: proto.String("KubernetesScheduler"),
+		Name: proto.String(config.DefaultFrameworkName),
 		User: proto.String(username),
 	}
 	if *mesosRole != "" {
 		info.Role = proto.String(*mesosRole)
 	}
-	if *mesosAuthPrincipal != "" {
-		info.Principal = proto.String(*mesosAuthPrincipal)
-		secret, err := ioutil.ReadFile(*mesosAuthSecretFile)
+	if principal := kmcloud.AuthenticationPrincipal(); principal != "" {
+		info.Principal = proto.String(principal)
+		secret, err := ioutil.ReadFile(kmcloud.AuthenticationSecretFile())
 		if err != nil {
 			return nil, nil, err
 		}
 		cred = &mesos.Credential{
-			Principal: proto.String(*mesosAuthPrincipal),
+			Principal: proto.String(principal),
 			Secret:    secret,
 		}
 	}
@@ -6,112 +6,490 @@ import (
 	"io/ioutil"
 	"net"
 	"net/http"
-	"strings"
+	"sync"
 	"time"
 
 	log "github.com/golang/glog"
-	"github.com/mesosphere/kubernetes-mesos/pkg/config"
+	kmconfig "github.com/mesosphere/kubernetes-mesos/pkg/config"
 	"golang.org/x/net/context"
 )
 
-const (
-	mesosHttpClientTimeout = 10 * time.Second //TODO(jdef) configurable via fiag?
-)
-
 type mesosClient struct {
-	mesosMaster string
-	client      *http.Client
-	tr          *http.Transport
+	detector      masterDetector
+	client        *http.Client
+	tr            *http.Transport
+	scheme        string // of master and slave endpoints: http or https
+	principal     string // for basic auth with masters and slaves, if not empty
+	secret        string
+	filter        *slaveFilter
+	slavesPath    string        // master endpoint that lists the slaves
+	stateRefresh  time.Duration // max age of the cached master state
+	probeWorkers  int           // max number of slaves probed concurrently
+	frameworkId   string        // of the k8sm scheduler, if known
+	frameworkName string        // of the k8sm scheduler, used when the id isn't known
+	lock          sync.Mutex
+	leader        string // cached host:port of the leading master, empty if unknown
+	cache         stateCache
+}
+
+// stateCache holds the last master state that was fetched successfully, and
+// the outcome of recent slave probes.
+type stateCache struct {
+	lock    sync.Mutex
+	state   *masterState
+	updated time.Time              // when state was fetched
+	refresh *stateRefresh          // in progress, nil if none
+	probes  map[string]probeResult // by slave pid
+}
+
+// stateRefresh is a fetch of the master state that concurrent lookups share
+type stateRefresh struct {
+	done chan struct{} // closed when the fetch completes
+	err  error         // of the fetch, valid once done is closed
+}
+
+type probeResult struct {
+	enlisted bool
+	probed   time.Time
 }
 
-func newMesosClient() *mesosClient {
-	tr := &http.Transport{}
-	return &mesosClient{
-		mesosMaster: MasterURI(),
+func newMesosClient(config *Config) (*mesosClient, error) {
+	timeout, err := config.httpTimeout()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := config.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	secret, err := config.secret()
+	if err != nil {
+		return nil, err
+	}
+	filter, err := config.slaveFilter()
+	if err != nil {
+		return nil, err
+	}
+	stateRefresh, err := config.stateRefreshInterval()
+	if err != nil {
+		return nil, err
+	}
+	tr := &http.Transport{TLSClientConfig: tlsConfig}
+	c := &mesosClient{
 		client: &http.Client{
 			Transport: tr,
-			Timeout:   mesosHttpClientTimeout,
+			Timeout:   timeout,
 		},
-		tr: tr,
+		tr:            tr,
+		scheme:        "http",
+		principal:     config.Mesos.Principal,
+		secret:        secret,
+		filter:        filter,
+		slavesPath:    "/state.json",
+		stateRefresh:  stateRefresh,
+		probeWorkers:  config.Mesos.SlaveProbeWorkers,
+		frameworkId:   config.Mesos.FrameworkId,
+		frameworkName: config.Mesos.FrameworkName,
+		cache:         stateCache{probes: map[string]probeResult{}},
+	}
+	if config.Mesos.SlavesEndpoint {
+		c.slavesPath = "/master/slaves"
+	}
+	if c.frameworkName == "" {
+		c.frameworkName = kmconfig.DefaultFrameworkName
+	}
+	if c.probeWorkers <= 0 {
+		c.probeWorkers = DefaultSlaveProbeWorkers
+	}
+	if config.Mesos.Https {
+		c.scheme = "https"
+	}
+	detector, err := newMasterDetector(config.Mesos.Masters, c)
+	if err != nil {
+		return nil, err
 	}
+	c.detector = detector
+	return c, nil
 }
 
-// return an array of host:port strings, each of which points to a mesos slave service
-func (c *mesosClient) EnumerateSlaves(ctx context.Context) ([]string, error) {
-	//TODO(jdef) probably should not assume that mesosMaster is a host:port
-	uri := fmt.Sprintf("http://%s/state.json", c.mesosMaster)
-	req, err := http.NewRequest("GET", uri, nil)
+// newRequest creates a GET request for the given path of a master or slave,
+// applying the configured scheme and credentials.
+func (c *mesosClient) newRequest(hostPort, path string) (*http.Request, error) {
+	req, err := http.NewRequest("GET", fmt.Sprintf("%s://%s%s", c.scheme, hostPort, path), nil)
 	if err != nil {
 		return nil, err
 	}
-	hosts := []string{}
-	err = c.httpDo(ctx, req, func(res *http.Response, err error) error {
+	if c.principal != "" {
+		req.SetBasicAuth(c.principal, c.secret)
+	}
+	return req, nil
+}
+
+// leadingMaster returns the host:port of the leading master, detecting it if
+// it isn't known.
+func (c *mesosClient) leadingMaster(ctx context.Context) (string, error) {
+	c.lock.Lock()
+	leader := c.leader
+	c.lock.Unlock()
+	if leader != "" {
+		return leader, nil
+	}
+	leader, err := c.detector.Leader(ctx)
+	if err != nil {
+		return "", err
+	}
+	log.V(1).Infof("Detected leading Mesos master %v", leader)
+	c.lock.Lock()
+	c.leader = leader
+	c.lock.Unlock()
+	return leader, nil
+}
+
+// forgetMaster clears the cached leader so that it's detected anew by the next
+// request, as happens after a master failover.
+func (c *mesosClient) forgetMaster(leader string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if c.leader == leader {
+		c.leader = ""
+	}
+}
+
+// slaveResources are the resources of a slave as reported in the master state
+type slaveResources struct {
+	Cpus  float64 `json:"cpus"`
+	Mem   float64 `json:"mem"`   // MB
+	Disk  float64 `json:"disk"`  // MB
+	Ports string  `json:"ports"` // ex: [31000-32000]
+}
+
+// slaveState is a slave as reported in the master state
+type slaveState struct {
+	Id         string                 `json:"id"`         // ex: 20150106-162714-3815890698-5050-2453-S2
+	Pid        string                 `json:"pid"`        // ex: slave(1)@10.22.211.18:5051
+	Hostname   string                 `json:"hostname"`   // ex: 10.22.211.18
+	Resources  slaveResources         `json:"resources"`  // total resources of the slave
+	Attributes map[string]interface{} `json:"attributes"` // text or scalar values
+}
+
+// attribute returns the value of a slave attribute as text
+func (s *slaveState) attribute(name string) (string, bool) {
+	value, found := s.Attributes[name]
+	if !found || value == nil {
+		return "", false
+	}
+	return fmt.Sprint(value), true
+}
+
+// executorState is an executor as reported in the master state
+type executorState struct {
+	ExecutorId string `json:"executor_id"`
+	SlaveId    string `json:"slave_id"`
+	Source     string `json:"source"`
+}
+
+// frameworkState is a framework as reported in the master state
+type frameworkState struct {
+	Id        string           `json:"id"`
+	Name      string           `json:"name"`
+	Executors *[]executorState `json:"executors"` // nil if the master doesn't report executors
+}
+
+type masterState struct {
+	Slaves     []*slaveState     `json:"slaves"`
+	Frameworks []*frameworkState `json:"frameworks"` // not reported by /master/slaves
+}
+
+// state returns the cached state of the leading master, refreshing it if it's
+// older than the refresh interval. Only one refresh is in flight at a time: while
+// it is, concurrent lookups get the stale state, or wait for the refresh if there
+// is none yet. If the refresh fails the stale state is returned instead; the age
+// of the state is reported by StateAge.
+func (c *mesosClient) state(ctx context.Context) (*masterState, error) {
+	c.cache.lock.Lock()
+	if c.cache.state != nil && (c.cache.refresh != nil || time.Since(c.cache.updated) < c.stateRefresh) {
+		state := c.cache.state
+		c.cache.lock.Unlock()
+		return state, nil
+	}
+	if refresh := c.cache.refresh; refresh != nil {
+		c.cache.lock.Unlock()
+		select {
+		case <-refresh.done:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		if refresh.err != nil {
+			return nil, refresh.err
+		}
+		c.cache.lock.Lock()
+		defer c.cache.lock.Unlock()
+		return c.cache.state, nil
+	}
+	refresh := &stateRefresh{done: make(chan struct{})}
+	c.cache.refresh = refresh
+	c.cache.lock.Unlock()
+
+	// the fetch may take up to the http timeout, so it mustn't hold the lock
+	state, err := c.fetchState(ctx)
+
+	c.cache.lock.Lock()
+	defer c.cache.lock.Unlock()
+	c.cache.refresh = nil
+	refresh.err = err
+	close(refresh.done)
+	if err != nil {
+		if c.cache.state == nil {
+			return nil, err
+		}
+		log.Warningf("Failed to refresh mesos state, using state from %v ago: %v", time.Since(c.cache.updated), err)
+		return c.cache.state, nil
+	}
+	c.cache.state = state
+	c.cache.updated = time.Now()
+	return state, nil
+}
+
+// StateAge returns the time since the master state was last fetched successfully,
+// or false if it never was.
+func (c *mesosClient) StateAge() (time.Duration, bool) {
+	c.cache.lock.Lock()
+	defer c.cache.lock.Unlock()
+	if c.cache.state == nil {
+		return 0, false
+	}
+	return time.Since(c.cache.updated), true
+}
+
+// fetch the state of the leading master
+func (c *mesosClient) fetchState(ctx context.Context) (*masterState, error) {
+	state := &masterState{}
+	if err := c.getMasterJSON(ctx, c.slavesPath, state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// getMasterJSON decodes the JSON response to a GET of the given path of the
+// leading master into v.
+func (c *mesosClient) getMasterJSON(ctx context.Context, path string, v interface{}) error {
+	master, err := c.leadingMaster(ctx)
+	if err != nil {
+		return err
+	}
+	req, err := c.newRequest(master, path)
+	if err != nil {
+		return err
+	}
+	return c.httpDo(ctx, req, func(res *http.Response, err error) error {
 		if err != nil {
+			c.forgetMaster(master)
 			return err
 		}
 		defer res.Body.Close()
 		if res.StatusCode != 200 {
+			c.forgetMaster(master)
 			return fmt.Errorf("HTTP request failed with code %d: %v", res.StatusCode, res.Status)
 		}
 		blob, err1 := ioutil.ReadAll(res.Body)
 		if err1 != nil {
 			return err1
 		}
-		log.V(3).Infof("Got mesos state, content length %v", len(blob))
-		type State struct {
-			Slaves []*struct {
-				Id       string `json:"id"`       // ex: 20150106-162714-3815890698-5050-2453-S2
-				Pid      string `json:"pid"`      // ex: slave(1)@10.22.211.18:5051
-				Hostname string `json:"hostname"` // ex: 10.22.211.18
-			} `json:"slaves"`
+		log.V(3).Infof("Got mesos %v, content length %v", path, len(blob))
+		return json.Unmarshal(blob, v)
+	})
+}
+
+// ClusterName returns the name of the Mesos cluster as reported by the leading
+// master, which is empty unless the masters were started with --cluster.
+func (c *mesosClient) ClusterName(ctx context.Context) (string, error) {
+	state := &struct {
+		Cluster string `json:"cluster"`
+	}{}
+	if err := c.getMasterJSON(ctx, "/state.json", state); err != nil {
+		return "", err
+	}
+	return state.Cluster, nil
+}
+
+// return an array of host:port strings, each of which points to a mesos slave service
+func (c *mesosClient) EnumerateSlaves(ctx context.Context) ([]string, error) {
+	state, err := c.state(ctx)
+	if err != nil {
+		return nil, err
+	}
+	hosts := []string{}
+	for _, slave := range state.Slaves {
+		if !c.filter.matches(slave) {
+			log.V(3).Infof("Slave %v excluded by filter", slave.Hostname)
+			continue
 		}
-		state := &State{}
-		err = json.Unmarshal(blob, state)
-		if err != nil {
-			return err
+		if slave.Pid != "" {
+			if host, err := parseUPID(slave.Pid); err == nil {
+				hosts = append(hosts, host)
+			} else {
+				log.Warning(err)
+			}
 		}
-		for _, slave := range state.Slaves {
-			if slave.Pid != "" {
-				if parts := strings.SplitN(slave.Pid, "@", 2); len(parts) == 2 && len(parts[1]) > 0 {
-					hosts = append(hosts, parts[1])
-				} else {
-					log.Warningf("unparsable slave pid: %v", slave.Pid)
-				}
+	}
+	return hosts, nil
+}
+
+// return the slave known by the given host name, which may be either the host
+// name that the slave registered with or the host of its pid
+func (c *mesosClient) Slave(ctx context.Context, name string) (*slaveState, bool, error) {
+	state, err := c.state(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, slave := range state.Slaves {
+		if slave.Hostname == name {
+			return slave, true, nil
+		}
+		if hostPort, err := parseUPID(slave.Pid); err == nil {
+			if host, _, err := net.SplitHostPort(hostPort); err == nil && host == name {
+				return slave, true, nil
 			}
 		}
-		return nil
-	})
-	return hosts, err
+	}
+	return nil, false, nil
 }
 
-// return a list of slaves running a k8sm kubelet/executor
+// isKubernetesFramework returns true if the framework with the given id and name
+// is the k8sm scheduler.
+func (c *mesosClient) isKubernetesFramework(id, name string) bool {
+	if c.frameworkId != "" {
+		return id == c.frameworkId
+	}
+	return name == c.frameworkName
+}
+
+// return a list of slaves running a k8sm kubelet/executor. The executors are
+// read from the master state when it reports them, otherwise every slave is
+// probed.
 func (c *mesosClient) EnlistedSlaves(ctx context.Context) ([]string, error) {
+	state, err := c.state(ctx)
+	if err != nil {
+		return nil, err
+	}
+	slaveIds := map[string]bool{}
+	reported := false
+	for _, f := range state.Frameworks {
+		if !c.isKubernetesFramework(f.Id, f.Name) || f.Executors == nil {
+			continue
+		}
+		reported = true
+		for _, e := range *f.Executors {
+			if e.ExecutorId == kmconfig.DefaultInfoID && (e.Source == "" || e.Source == kmconfig.DefaultInfoSource) {
+				slaveIds[e.SlaveId] = true
+			}
+		}
+	}
+	if !reported {
+		log.V(2).Info("Master state doesn't report k8sm executors, probing slaves")
+		return c.probeEnlistedSlaves(ctx)
+	}
+	hosts := []string{}
+	for _, slave := range state.Slaves {
+		if !slaveIds[slave.Id] || !c.filter.matches(slave) {
+			continue
+		}
+		hostPort, err := parseUPID(slave.Pid)
+		if err != nil {
+			log.Warning(err)
+			continue
+		}
+		if host, _, err := net.SplitHostPort(hostPort); err == nil {
+			hosts = append(hosts, host)
+		} else {
+			log.V(1).Infof("failed to parse slave host from host:port '%v'", hostPort)
+		}
+	}
+	return hosts, nil
+}
+
+// return a list of slaves running a k8sm kubelet/executor. Slaves are probed
+// concurrently, by at most probeWorkers at a time, and the outcome of a probe is
+// reused for the state refresh interval.
+func (c *mesosClient) probeEnlistedSlaves(ctx context.Context) ([]string, error) {
 	slaves, err := c.EnumerateSlaves(ctx)
 	if err != nil {
 		return nil, err
 	}
 
-	//TODO(jdef) should parallelize this
-	results := []string{}
-	for _, slave := range slaves {
-		if found, err := c.slaveRunningKubeletExecutor(ctx, slave); found {
-			// parse the host from the slave host:port
-			if host, _, err := net.SplitHostPort(slave); err == nil {
-				results = append(results, host)
-			} else {
-				log.V(1).Infof("failed to parse slave host from host:port '%v'", slave)
+	type probe struct {
+		slave    string
+		enlisted bool
+	}
+	work := make(chan string)
+	done := make(chan probe)
+	var wg sync.WaitGroup
+	for i := 0; i < c.probeWorkers && i < len(slaves); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for slave := range work {
+				done <- probe{slave, c.probeSlave(ctx, slave)}
+			}
+		}()
+	}
+	go func() {
+		defer close(work)
+		for _, slave := range slaves {
+			select {
+			case work <- slave:
+			case <-ctx.Done():
+				return
 			}
-		} else if err != nil {
-			// swallow the error and move on to the next
-			log.Warningf("failed to test slave for presence of kubelet-executor: %v", err)
+		}
+	}()
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	results := []string{}
+	for p := range done {
+		if !p.enlisted {
+			continue
+		}
+		// parse the host from the slave host:port
+		if host, _, err := net.SplitHostPort(p.slave); err == nil {
+			results = append(results, host)
+		} else {
+			log.V(1).Infof("failed to parse slave host from host:port '%v'", p.slave)
 		}
 	}
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
 	return results, nil
 }
 
+// probeSlave reports whether a slave runs a k8sm kubelet/executor, reusing the
+// outcome of a recent probe if there was one.
+func (c *mesosClient) probeSlave(ctx context.Context, slave string) bool {
+	c.cache.lock.Lock()
+	result, found := c.cache.probes[slave]
+	c.cache.lock.Unlock()
+	if found && time.Since(result.probed) < c.stateRefresh {
+		return result.enlisted
+	}
+
+	enlisted, err := c.slaveRunningKubeletExecutor(ctx, slave)
+	if err != nil {
+		// swallow the error and move on to the next
+		log.Warningf("failed to test slave for presence of kubelet-executor: %v", err)
+		return false
+	}
+	c.cache.lock.Lock()
+	c.cache.probes[slave] = probeResult{enlisted: enlisted, probed: time.Now()}
+	c.cache.lock.Unlock()
+	return enlisted
+}
+
 func (c *mesosClient) slaveRunningKubeletExecutor(ctx context.Context, slaveHostPort string) (bool, error) {
-	uri := fmt.Sprintf("http://%s/state.json", slaveHostPort)
-	req, err := http.NewRequest("GET", uri, nil)
+	req, err := c.newRequest(slaveHostPort, "/state.json")
 	if err != nil {
 		return false, err
 	}
@@ -131,6 +509,8 @@ func (c *mesosClient) slaveRunningKubeletExecutor(ctx context.Context, slaveHost
 		log.V(3).Infof("Got mesos slave state, content length %v", len(blob))
 		type State struct {
 			Frameworks []*struct {
+				Id        string `json:"id"`
+				Name      string `json:"name"`
 				Executors []*struct {
 					ID     string `json:"id"`
 					Source string `json:"source"`
@@ -143,8 +523,11 @@ func (c *mesosClient) slaveRunningKubeletExecutor(ctx context.Context, slaveHost
 			return err
 		}
 		for _, f := range state.Frameworks {
+			if !c.isKubernetesFramework(f.Id, f.Name) {
+				continue
+			}
 			for _, e := range f.Executors {
-				if e.Source == config.DefaultInfoSource && e.ID == config.DefaultInfoID {
+				if e.Source == kmconfig.DefaultInfoSource && e.ID == kmconfig.DefaultInfoID {
 					found = true
 					return nil
 				}
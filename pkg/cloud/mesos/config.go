@@ -0,0 +1,252 @@
+package mesos
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"code.google.com/p/gcfg"
+)
+
+const (
+	DefaultHttpTimeout          = 10 * time.Second
+	DefaultStateRefreshInterval = 10 * time.Second
+	DefaultSlaveProbeWorkers    = 10
+)
+
+// Config is the cloud config file of the mesos cloud provider, ex:
+//
+//	[mesos]
+//	masters = zk://10.0.0.1:2181,10.0.0.2:2181/mesos
+//	http-timeout = 5s
+//	state-refresh-interval = 30s
+//	slave-probe-workers = 50
+//	slaves-endpoint = true
+//	https = true
+//	ca-file = /etc/mesos/ca.pem
+//	principal = k8sm
+//	secret-file = /etc/mesos/k8sm.secret
+//
+//	[zones]
+//	failure-domain-attribute = rack
+//	region-attribute = dc
+//
+//	[slaves]
+//	attribute = k8s:true
+//	hostname-pattern = "^node-[0-9]+\\.example\\.com$"
+//	dns-fallback = false
+//
+//	[loadbalancer]
+//	backend = haproxy
+//	address = 10.0.0.100
+//	haproxy-config-dir = /etc/haproxy/k8sm.d
+//	haproxy-reload-command = systemctl reload haproxy
+type Config struct {
+	Mesos struct {
+		// location of the masters, in any form accepted by -mesos_master,
+		// which this overrides
+		Masters     string `gcfg:"masters"`
+		HttpTimeout string `gcfg:"http-timeout"` // ex: 10s
+
+		// how long the master state and the outcome of slave probes are cached,
+		// ex: 30s; 0 disables caching
+		StateRefreshInterval string `gcfg:"state-refresh-interval"`
+		// max number of slaves probed concurrently for a kubelet-executor
+		SlaveProbeWorkers int `gcfg:"slave-probe-workers"`
+		// list slaves with the lighter /master/slaves endpoint rather than /state.json;
+		// since that endpoint doesn't report executors, slaves must then be probed
+		// to find those running the kubelet-executor
+		SlavesEndpoint bool `gcfg:"slaves-endpoint"`
+
+		// identify the k8sm scheduler among the frameworks running on slaves; the
+		// name defaults to the framework name that the scheduler registers with
+		FrameworkId   string `gcfg:"framework-id"`
+		FrameworkName string `gcfg:"framework-name"`
+
+		// TLS and credentials for requests to masters and slaves; https:// masters
+		// require https = true. The principal and secret default to
+		// -mesos_authentication_principal and -mesos_authentication_secret_file.
+		Https      bool   `gcfg:"https"`
+		CAFile     string `gcfg:"ca-file"`   // PEM bundle of CAs to verify masters and slaves with
+		CertFile   string `gcfg:"cert-file"` // PEM client certificate
+		KeyFile    string `gcfg:"key-file"`  // PEM private key of the client certificate
+		Principal  string `gcfg:"principal"`
+		SecretFile string `gcfg:"secret-file"` // file containing the secret of the principal
+	}
+	Zones struct {
+		// slave attributes that identify the failure domain and region of a slave;
+		// zone support is disabled unless a failure domain attribute is configured
+		FailureDomainAttribute string `gcfg:"failure-domain-attribute"`
+		RegionAttribute        string `gcfg:"region-attribute"`
+	}
+	Slaves struct {
+		// only slaves having all of these attributes, each given as name:value,
+		// are considered instances of the cloud
+		Attribute []string `gcfg:"attribute"`
+		// only slaves whose host name matches this regular expression are
+		// considered instances of the cloud
+		HostnamePattern string `gcfg:"hostname-pattern"`
+		// resolve the IP address of an instance with DNS when Mesos can't tell
+		DnsFallback bool `gcfg:"dns-fallback"`
+	}
+	LoadBalancer struct {
+		// name of the load balancer backend, ex: haproxy; TCP load balancers are
+		// disabled unless a backend is configured
+		Backend string `gcfg:"backend"`
+		// IP address of the balancer, for services that don't request an external IP
+		Address string `gcfg:"address"`
+		// haproxy backend: directory of the generated configuration files, and the
+		// command that makes haproxy reload them
+		HAProxyConfigDir     string `gcfg:"haproxy-config-dir"`
+		HAProxyReloadCommand string `gcfg:"haproxy-reload-command"`
+	}
+}
+
+// readConfig reads the cloud config, which is optional: a nil reader yields the
+// default config.
+func readConfig(r io.Reader) (*Config, error) {
+	config := &Config{}
+	if r == nil {
+		return config, nil
+	}
+	if f, ok := r.(*os.File); ok && f == nil {
+		return config, nil
+	}
+	if err := gcfg.ReadInto(config, r); err != nil {
+		return nil, err
+	}
+	if err := config.validate(); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+func (c *Config) validate() error {
+	if _, err := c.httpTimeout(); err != nil {
+		return err
+	}
+	if _, err := c.stateRefreshInterval(); err != nil {
+		return err
+	}
+	if c.Mesos.SlaveProbeWorkers < 0 {
+		return fmt.Errorf("slave-probe-workers must not be negative")
+	}
+	if _, err := c.slaveFilter(); err != nil {
+		return err
+	}
+	if (c.Mesos.CertFile == "") != (c.Mesos.KeyFile == "") {
+		return fmt.Errorf("cert-file and key-file must be specified together")
+	}
+	if c.Mesos.SecretFile != "" && c.Mesos.Principal == "" {
+		return fmt.Errorf("secret-file requires a principal")
+	}
+	if addr := c.LoadBalancer.Address; addr != "" && net.ParseIP(addr) == nil {
+		return fmt.Errorf("invalid load balancer address %q", addr)
+	}
+	return nil
+}
+
+func (c *Config) httpTimeout() (time.Duration, error) {
+	if c.Mesos.HttpTimeout == "" {
+		return DefaultHttpTimeout, nil
+	}
+	timeout, err := time.ParseDuration(c.Mesos.HttpTimeout)
+	if err != nil {
+		return 0, fmt.Errorf("invalid http-timeout %q: %v", c.Mesos.HttpTimeout, err)
+	}
+	return timeout, nil
+}
+
+func (c *Config) stateRefreshInterval() (time.Duration, error) {
+	if c.Mesos.StateRefreshInterval == "" {
+		return DefaultStateRefreshInterval, nil
+	}
+	interval, err := time.ParseDuration(c.Mesos.StateRefreshInterval)
+	if err != nil {
+		return 0, fmt.Errorf("invalid state-refresh-interval %q: %v", c.Mesos.StateRefreshInterval, err)
+	}
+	return interval, nil
+}
+
+// tlsConfig returns the TLS configuration for requests to masters and slaves, or nil
+// if the defaults apply.
+func (c *Config) tlsConfig() (*tls.Config, error) {
+	if c.Mesos.CAFile == "" && c.Mesos.CertFile == "" {
+		return nil, nil
+	}
+	config := &tls.Config{}
+	if c.Mesos.CAFile != "" {
+		pem, err := ioutil.ReadFile(c.Mesos.CAFile)
+		if err != nil {
+			return nil, err
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %q", c.Mesos.CAFile)
+		}
+	}
+	if c.Mesos.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.Mesos.CertFile, c.Mesos.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
+
+// secret returns the secret of the configured principal, if any.
+func (c *Config) secret() (string, error) {
+	if c.Mesos.SecretFile == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(c.Mesos.SecretFile)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// slaveFilter selects the slaves that are instances of the cloud
+type slaveFilter struct {
+	attributes map[string]string
+	hostname   *regexp.Regexp
+}
+
+func (c *Config) slaveFilter() (*slaveFilter, error) {
+	f := &slaveFilter{attributes: map[string]string{}}
+	for _, attr := range c.Slaves.Attribute {
+		parts := strings.SplitN(attr, ":", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid slave attribute filter %q, expected name:value", attr)
+		}
+		f.attributes[parts[0]] = parts[1]
+	}
+	if c.Slaves.HostnamePattern != "" {
+		re, err := regexp.Compile(c.Slaves.HostnamePattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid hostname-pattern: %v", err)
+		}
+		f.hostname = re
+	}
+	return f, nil
+}
+
+func (f *slaveFilter) matches(slave *slaveState) bool {
+	if f.hostname != nil && !f.hostname.MatchString(slave.Hostname) {
+		return false
+	}
+	for name, value := range f.attributes {
+		if actual, found := slave.attribute(name); !found || actual != value {
+			return false
+		}
+	}
+	return true
+}
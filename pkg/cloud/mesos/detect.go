@@ -0,0 +1,275 @@
+package mesos
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	log "github.com/golang/glog"
+	"github.com/mesos/mesos-go/mesos"
+	"github.com/samuel/go-zookeeper/zk"
+	"golang.org/x/net/context"
+)
+
+const (
+	zkSessionTimeout = 10 * time.Second
+	zkInfoPrefix     = "info_" // znodes of contending masters, suffixed with a sequence number
+)
+
+var noLeadingMaster = errors.New("No leading Mesos master found")
+
+// masterDetector finds the leading Mesos master.
+type masterDetector interface {
+	// Leader returns the host:port of the leading master.
+	Leader(ctx context.Context) (string, error)
+}
+
+// newMasterDetector returns a detector for the given master specification, which is
+// either a zk://host1:port1,host2:port2/path URL or a comma separated list of
+// master host:port pairs, each optionally prefixed by http:// or https://. The
+// scheme of every master must match that of the client, which is set by the https
+// key of the cloud config.
+func newMasterDetector(spec string, client *mesosClient) (masterDetector, error) {
+	if strings.HasPrefix(spec, "zk://") {
+		servers, path, err := parseZkURL(spec)
+		if err != nil {
+			return nil, err
+		}
+		return &zkDetector{
+			servers: servers,
+			path:    path,
+			dial:    dialZk,
+		}, nil
+	}
+	masters := []string{}
+	for _, m := range strings.Split(spec, ",") {
+		m = strings.TrimSpace(m)
+		if i := strings.Index(m, "://"); i >= 0 {
+			if scheme := m[:i]; scheme != client.scheme {
+				return nil, fmt.Errorf("Mesos master %q doesn't use the configured scheme %v, set https in the cloud config to match", m, client.scheme)
+			}
+			m = m[i+len("://"):]
+		}
+		if m == "" {
+			continue
+		}
+		if _, _, err := net.SplitHostPort(m); err != nil {
+			return nil, fmt.Errorf("invalid Mesos master %q: %v", m, err)
+		}
+		masters = append(masters, m)
+	}
+	if len(masters) == 0 {
+		return nil, fmt.Errorf("no Mesos masters specified in %q", spec)
+	}
+	return &httpDetector{masters: masters, client: client}, nil
+}
+
+// parses zk://host1:port1,host2:port2/path into its servers and path
+func parseZkURL(spec string) ([]string, string, error) {
+	rest := strings.TrimPrefix(spec, "zk://")
+	if at := strings.LastIndex(rest, "@"); at >= 0 {
+		// TODO(jdef) support zk credentials
+		rest = rest[at+1:]
+	}
+	slash := strings.Index(rest, "/")
+	if slash < 0 || slash == len(rest)-1 {
+		return nil, "", fmt.Errorf("missing znode path in ZooKeeper URL %q", spec)
+	}
+	servers := strings.Split(rest[:slash], ",")
+	for _, s := range servers {
+		if s == "" {
+			return nil, "", fmt.Errorf("empty server in ZooKeeper URL %q", spec)
+		}
+	}
+	return servers, strings.TrimSuffix(rest[slash:], "/"), nil
+}
+
+// parseUPID returns the host:port part of a libprocess PID, ex: master@10.22.211.18:5050
+func parseUPID(pid string) (string, error) {
+	if parts := strings.SplitN(pid, "@", 2); len(parts) == 2 && len(parts[1]) > 0 {
+		return parts[1], nil
+	}
+	return "", fmt.Errorf("unparsable pid: %v", pid)
+}
+
+// httpDetector asks each master in turn who the leader is.
+type httpDetector struct {
+	masters []string
+	client  *mesosClient
+}
+
+func (d *httpDetector) Leader(ctx context.Context) (string, error) {
+	var lastErr error = noLeadingMaster
+	for _, master := range d.masters {
+		leader, err := d.askLeader(ctx, master)
+		if err == nil {
+			log.V(2).Infof("Master %v reports leading master %v", master, leader)
+			return leader, nil
+		}
+		log.V(1).Infof("Failed to determine leading master from %v: %v", master, err)
+		lastErr = err
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return "", lastErr
+}
+
+// reads the pid of the leading master from the state of a master
+func (d *httpDetector) askLeader(ctx context.Context, master string) (string, error) {
+	req, err := d.client.newRequest(master, "/state.json")
+	if err != nil {
+		return "", err
+	}
+	leader := ""
+	err = d.client.httpDo(ctx, req, func(res *http.Response, err error) error {
+		if err != nil {
+			return err
+		}
+		defer res.Body.Close()
+		if res.StatusCode != 200 {
+			return fmt.Errorf("HTTP request failed with code %d: %v", res.StatusCode, res.Status)
+		}
+		blob, err := ioutil.ReadAll(res.Body)
+		if err != nil {
+			return err
+		}
+		state := &struct {
+			Leader string `json:"leader"` // ex: master@10.22.211.18:5050
+		}{}
+		if err = json.Unmarshal(blob, state); err != nil {
+			return err
+		}
+		if state.Leader == "" {
+			return noLeadingMaster
+		}
+		leader, err = parseUPID(state.Leader)
+		return err
+	})
+	return leader, err
+}
+
+// zkClient is the subset of ZooKeeper operations that master detection relies upon.
+type zkClient interface {
+	Children(path string) ([]string, error)
+	Get(path string) ([]byte, error)
+	Close()
+}
+
+type zkDialer func(servers []string, timeout time.Duration) (zkClient, error)
+
+// zkDetector reads the leading master from the znodes that masters create
+// when contending for leadership. The contender with the lowest sequence
+// number is the leader.
+type zkDetector struct {
+	servers []string
+	path    string
+	dial    zkDialer
+	lock    sync.Mutex
+	conn    zkClient // lazily connected, reset upon error
+}
+
+func (d *zkDetector) Leader(ctx context.Context) (string, error) {
+	ch := make(chan struct {
+		leader string
+		err    error
+	}, 1)
+	go func() {
+		leader, err := d.leader()
+		ch <- struct {
+			leader string
+			err    error
+		}{leader, err}
+	}()
+	select {
+	case <-ctx.Done():
+		return "", ctx.Err()
+	case result := <-ch:
+		return result.leader, result.err
+	}
+}
+
+func (d *zkDetector) leader() (string, error) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.conn == nil {
+		conn, err := d.dial(d.servers, zkSessionTimeout)
+		if err != nil {
+			return "", err
+		}
+		d.conn = conn
+	}
+	leader, err := d.readLeader()
+	if err != nil {
+		// reconnect next time, in case the session is broken
+		d.conn.Close()
+		d.conn = nil
+	}
+	return leader, err
+}
+
+// Assumes that the caller is locking around the zk connection.
+func (d *zkDetector) readLeader() (string, error) {
+	children, err := d.conn.Children(d.path)
+	if err != nil {
+		return "", err
+	}
+	contenders := []string{}
+	for _, child := range children {
+		if strings.HasPrefix(child, zkInfoPrefix) {
+			contenders = append(contenders, child)
+		}
+	}
+	if len(contenders) == 0 {
+		return "", noLeadingMaster
+	}
+	// sequence numbers are zero padded, so lexical order is numerical order
+	sort.Strings(contenders)
+	data, err := d.conn.Get(d.path + "/" + contenders[0])
+	if err != nil {
+		return "", err
+	}
+	return parseMasterInfo(data)
+}
+
+// parseMasterInfo extracts the host:port of a master from the data of its znode,
+// which is either a serialized MasterInfo or, for older masters, a plain pid.
+func parseMasterInfo(data []byte) (string, error) {
+	info := &mesos.MasterInfo{}
+	if err := proto.Unmarshal(data, info); err == nil && info.GetPid() != "" {
+		return parseUPID(info.GetPid())
+	}
+	return parseUPID(strings.TrimSpace(string(data)))
+}
+
+// adapts a ZooKeeper connection to zkClient
+type zkConn struct {
+	*zk.Conn
+}
+
+func dialZk(servers []string, timeout time.Duration) (zkClient, error) {
+	conn, _, err := zk.Connect(servers, timeout)
+	if err != nil {
+		return nil, err
+	}
+	return &zkConn{conn}, nil
+}
+
+func (c *zkConn) Children(path string) ([]string, error) {
+	children, _, err := c.Conn.Children(path)
+	return children, err
+}
+
+func (c *zkConn) Get(path string) ([]byte, error) {
+	data, _, err := c.Conn.Get(path)
+	return data, err
+}
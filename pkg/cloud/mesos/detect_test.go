@@ -0,0 +1,274 @@
+package mesos
+
+import (
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/mesos/mesos-go/mesos"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+// fakeZk is an in-memory stand-in for a ZooKeeper ensemble
+type fakeZk struct {
+	nodes  map[string][]byte // full path => data
+	dials  int
+	closed int
+	err    error // returned by every operation when set
+}
+
+func (f *fakeZk) dial(servers []string, timeout time.Duration) (zkClient, error) {
+	f.dials++
+	return f, nil
+}
+
+func (f *fakeZk) Children(path string) ([]string, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	children := []string{}
+	for p := range f.nodes {
+		if strings.HasPrefix(p, path+"/") {
+			children = append(children, strings.TrimPrefix(p, path+"/"))
+		}
+	}
+	return children, nil
+}
+
+func (f *fakeZk) Get(path string) ([]byte, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if data, found := f.nodes[path]; found {
+		return data, nil
+	}
+	return nil, errors.New("no such node")
+}
+
+func (f *fakeZk) Close() {
+	f.closed++
+}
+
+func masterInfo(pid string) []byte {
+	data, _ := proto.Marshal(&mesos.MasterInfo{
+		Id:   proto.String("master-id"),
+		Ip:   proto.Uint32(0),
+		Port: proto.Uint32(5050),
+		Pid:  proto.String(pid),
+	})
+	return data
+}
+
+func testConfig(masters string) *Config {
+	config := &Config{}
+	config.Mesos.Masters = masters
+	return config
+}
+
+// newMasterServer returns a fake master whose state reports the given leader
+func newMasterServer(leader string) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, `{"leader":%q,"slaves":[]}`, leader)
+	}))
+}
+
+func TestParseZkURL(t *testing.T) {
+	assert := assert.New(t)
+
+	servers, path, err := parseZkURL("zk://10.0.0.1:2181,10.0.0.2:2181/mesos")
+	assert.NoError(err)
+	assert.Equal([]string{"10.0.0.1:2181", "10.0.0.2:2181"}, servers)
+	assert.Equal("/mesos", path)
+
+	_, _, err = parseZkURL("zk://10.0.0.1:2181")
+	assert.Error(err)
+}
+
+func TestZkDetector_Leader(t *testing.T) {
+	assert := assert.New(t)
+	fake := &fakeZk{nodes: map[string][]byte{
+		"/mesos/info_0000000012": masterInfo("master@10.0.0.2:5050"),
+		"/mesos/info_0000000011": masterInfo("master@10.0.0.1:5050"),
+		"/mesos/log_replicas":    []byte("ignored"),
+	}}
+	d := &zkDetector{servers: []string{"zk1:2181"}, path: "/mesos", dial: fake.dial}
+
+	leader, err := d.Leader(context.Background())
+	assert.NoError(err)
+	assert.Equal("10.0.0.1:5050", leader)
+
+	// failover: the old leader's znode goes away
+	delete(fake.nodes, "/mesos/info_0000000011")
+	leader, err = d.Leader(context.Background())
+	assert.NoError(err)
+	assert.Equal("10.0.0.2:5050", leader)
+	assert.Equal(1, fake.dials)
+}
+
+func TestZkDetector_PlainPid(t *testing.T) {
+	fake := &fakeZk{nodes: map[string][]byte{
+		"/mesos/info_0000000001": []byte("master@10.0.0.3:5050"),
+	}}
+	d := &zkDetector{path: "/mesos", dial: fake.dial}
+	leader, err := d.Leader(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.3:5050", leader)
+}
+
+func TestZkDetector_ReconnectsAfterError(t *testing.T) {
+	assert := assert.New(t)
+	fake := &fakeZk{nodes: map[string][]byte{}, err: errors.New("session expired")}
+	d := &zkDetector{path: "/mesos", dial: fake.dial}
+
+	_, err := d.Leader(context.Background())
+	assert.Error(err)
+	assert.Equal(1, fake.closed)
+
+	fake.err = nil
+	_, err = d.Leader(context.Background())
+	assert.Equal(noLeadingMaster, err)
+	assert.Equal(2, fake.dials)
+}
+
+func TestHttpDetector_SkipsDeadMasters(t *testing.T) {
+	assert := assert.New(t)
+	srv := newMasterServer("master@10.0.0.5:5050")
+	defer srv.Close()
+
+	dead := httptest.NewServer(http.NotFoundHandler())
+	deadAddr := strings.TrimPrefix(dead.URL, "http://")
+	dead.Close()
+
+	client, err := newMesosClient(testConfig(deadAddr + "," + strings.TrimPrefix(srv.URL, "http://")))
+	assert.NoError(err)
+	leader, err := client.leadingMaster(context.Background())
+	assert.NoError(err)
+	assert.Equal("10.0.0.5:5050", leader)
+}
+
+func TestMesosClient_ReresolvesOnFailure(t *testing.T) {
+	assert := assert.New(t)
+	leader := newMasterServer("")
+	defer leader.Close()
+	leaderAddr := strings.TrimPrefix(leader.URL, "http://")
+
+	fake := &fakeZk{nodes: map[string][]byte{
+		"/mesos/info_0000000001": masterInfo("master@" + leaderAddr),
+	}}
+	config := testConfig("zk://zk1:2181/mesos")
+	config.Mesos.StateRefreshInterval = "0s"
+	client, err := newMesosClient(config)
+	assert.NoError(err)
+	client.detector.(*zkDetector).dial = fake.dial
+
+	_, err = client.EnumerateSlaves(context.Background())
+	assert.NoError(err)
+
+	// the leader dies and another master takes over
+	leader.Close()
+	standby := newMasterServer("")
+	defer standby.Close()
+	standbyAddr := strings.TrimPrefix(standby.URL, "http://")
+	fake.nodes = map[string][]byte{
+		"/mesos/info_0000000002": masterInfo("master@" + standbyAddr),
+	}
+
+	// the stale state is served while the new leader is detected
+	_, err = client.EnumerateSlaves(context.Background())
+	assert.NoError(err)
+	_, err = client.EnumerateSlaves(context.Background())
+	assert.NoError(err)
+	current, err := client.leadingMaster(context.Background())
+	assert.NoError(err)
+	assert.Equal(standbyAddr, current)
+}
+
+func TestMesosClient_HttpsWithBasicAuth(t *testing.T) {
+	assert := assert.New(t)
+	var addr string
+	srv := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if user, pass, ok := basicAuth(req); !ok || user != "k8sm" || pass != "s3cret" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		fmt.Fprintf(w, `{"leader":"master@%s","slaves":[]}`, addr)
+	}))
+	defer srv.Close()
+	addr = strings.TrimPrefix(srv.URL, "https://")
+
+	dir, err := ioutil.TempDir("", "k8sm-cloud")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	caFile := filepath.Join(dir, "ca.pem")
+	ca := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.TLS.Certificates[0].Certificate[0]})
+	secretFile := filepath.Join(dir, "secret")
+	assert.NoError(ioutil.WriteFile(caFile, ca, 0600))
+	assert.NoError(ioutil.WriteFile(secretFile, []byte("s3cret\n"), 0600))
+
+	config := testConfig("https://" + addr)
+	config.Mesos.Https = true
+	config.Mesos.CAFile = caFile
+	config.Mesos.Principal = "k8sm"
+	config.Mesos.SecretFile = secretFile
+	client, err := newMesosClient(config)
+	assert.NoError(err)
+
+	leader, err := client.leadingMaster(context.Background())
+	assert.NoError(err)
+	assert.Equal(addr, leader)
+	_, err = client.EnumerateSlaves(context.Background())
+	assert.NoError(err)
+
+	// without credentials the master refuses the request
+	config.Mesos.Principal = ""
+	config.Mesos.SecretFile = ""
+	client, err = newMesosClient(config)
+	assert.NoError(err)
+	_, err = client.leadingMaster(context.Background())
+	assert.Error(err)
+}
+
+func TestMesosClient_MasterSchemes(t *testing.T) {
+	assert := assert.New(t)
+	_, err := newMesosClient(testConfig("http://10.0.0.1:5050,10.0.0.2:5050"))
+	assert.NoError(err)
+
+	// one https master doesn't switch the others to https
+	_, err = newMesosClient(testConfig("10.0.0.1:5050,https://10.0.0.2:5050"))
+	assert.Error(err)
+
+	config := testConfig("https://10.0.0.1:5050,10.0.0.2:5050")
+	config.Mesos.Https = true
+	_, err = newMesosClient(config)
+	assert.NoError(err)
+	config.Mesos.Masters = "https://10.0.0.1:5050,http://10.0.0.2:5050"
+	_, err = newMesosClient(config)
+	assert.Error(err)
+}
+
+// basicAuth parses the credentials of a request, which net/http doesn't do for us
+func basicAuth(req *http.Request) (user, pass string, ok bool) {
+	auth := strings.TrimPrefix(req.Header.Get("Authorization"), "Basic ")
+	decoded, err := base64.StdEncoding.DecodeString(auth)
+	if err != nil {
+		return "", "", false
+	}
+	parts := strings.SplitN(string(decoded), ":", 2)
+	if len(parts) != 2 {
+		return "", "", false
+	}
+	return parts[0], parts[1], true
+}
@@ -0,0 +1,165 @@
+package mesos
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"text/template"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	log "github.com/golang/glog"
+)
+
+const (
+	// the first line of a generated config file records the balancer it was generated for
+	haproxyMetadataPrefix = "# k8sm-loadbalancer "
+)
+
+var (
+	unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9_.-]`)
+
+	haproxyTemplate = template.Must(template.New("haproxy").Parse(`{{.Metadata}}
+frontend {{.Id}}
+	bind {{.LB.ExternalIP}}:{{.LB.Port}}
+	mode tcp
+	default_backend {{.Id}}
+
+backend {{.Id}}
+	mode tcp
+	balance {{if .ClientIPAffinity}}source{{else}}roundrobin{{end}}
+{{range .LB.Hosts}}	server {{.}} {{.}}:{{$.LB.Port}} check
+{{end}}`))
+)
+
+func init() {
+	RegisterLoadBalancerBackend("haproxy", newHAProxyBackend)
+}
+
+// haproxyBackend writes the configuration of each load balancer to a file of
+// its own in a directory that haproxy loads, ex: haproxy -f /etc/haproxy/k8sm.d,
+// and optionally runs a command to make haproxy reload its configuration.
+type haproxyBackend struct {
+	dir       string
+	reloadCmd string
+	lock      sync.Mutex
+}
+
+func newHAProxyBackend(config *Config) (LoadBalancerBackend, error) {
+	dir := config.LoadBalancer.HAProxyConfigDir
+	if dir == "" {
+		return nil, fmt.Errorf("the haproxy load balancer backend requires haproxy-config-dir")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &haproxyBackend{
+		dir:       dir,
+		reloadCmd: config.LoadBalancer.HAProxyReloadCommand,
+	}, nil
+}
+
+// name of the haproxy frontend and backend of a load balancer, and of its config
+// file. Names are sanitized for readability and suffixed with a hash of the
+// original region and name, so that distinct balancers never share a file.
+func haproxyId(name, region string) string {
+	id := "k8sm-" + name
+	if region != "" {
+		id = "k8sm-" + region + "-" + name
+	}
+	sum := sha1.Sum([]byte(region + "\x00" + name))
+	return unsafeNameChars.ReplaceAllString(id, "_") + "-" + hex.EncodeToString(sum[:8])
+}
+
+func (b *haproxyBackend) path(name, region string) string {
+	return filepath.Join(b.dir, haproxyId(name, region)+".cfg")
+}
+
+func (b *haproxyBackend) Get(name, region string) (*LoadBalancer, bool, error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	f, err := os.Open(b.path(name, region))
+	if os.IsNotExist(err) {
+		return nil, false, nil
+	} else if err != nil {
+		return nil, false, err
+	}
+	defer f.Close()
+	line, err := bufio.NewReader(f).ReadString('\n')
+	if err != nil || !strings.HasPrefix(line, haproxyMetadataPrefix) {
+		return nil, false, fmt.Errorf("%v was not generated for a load balancer", f.Name())
+	}
+	lb := &LoadBalancer{}
+	if err := json.Unmarshal([]byte(strings.TrimPrefix(line, haproxyMetadataPrefix)), lb); err != nil {
+		return nil, false, err
+	}
+	return lb, true, nil
+}
+
+func (b *haproxyBackend) Put(lb *LoadBalancer) error {
+	metadata, err := json.Marshal(lb)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	err = haproxyTemplate.Execute(buf, struct {
+		Metadata         string
+		Id               string
+		LB               *LoadBalancer
+		ClientIPAffinity bool
+	}{haproxyMetadataPrefix + string(metadata), haproxyId(lb.Name, lb.Region), lb, lb.Affinity == api.AffinityTypeClientIP})
+	if err != nil {
+		return err
+	}
+
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	// write to a temp file and rename, so that haproxy never reads a partial file
+	path := b.path(lb.Name, lb.Region)
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	log.V(2).Infof("Wrote haproxy config for load balancer %v to %v", lb.Name, path)
+	return b.reload()
+}
+
+func (b *haproxyBackend) Delete(name, region string) error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	err := os.Remove(b.path(name, region))
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	log.V(2).Infof("Removed haproxy config for load balancer %v", name)
+	return b.reload()
+}
+
+// Assumes that the caller is locking around the config directory.
+func (b *haproxyBackend) reload() error {
+	if b.reloadCmd == "" {
+		return nil
+	}
+	out, err := exec.Command("/bin/sh", "-c", b.reloadCmd).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to reload haproxy: %v: %s", err, out)
+	}
+	return nil
+}
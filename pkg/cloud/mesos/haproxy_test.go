@@ -0,0 +1,71 @@
+package mesos
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHAProxyLoadBalancer(t *testing.T) {
+	assert := assert.New(t)
+	dir, err := ioutil.TempDir("", "k8sm-haproxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := &Config{}
+	config.LoadBalancer.Backend = "haproxy"
+	config.LoadBalancer.Address = "10.0.0.100"
+	config.LoadBalancer.HAProxyConfigDir = dir
+	lb, err := newLoadBalancerBackend(config)
+	assert.NoError(err)
+	cloud := &MesosCloud{config: config, lb: lb}
+
+	balancers, supported := cloud.TCPLoadBalancer()
+	assert.True(supported)
+
+	ip, err := balancers.CreateTCPLoadBalancer("frontend", "", nil, 80, []string{"10.0.0.1", "10.0.0.2"}, api.AffinityTypeClientIP)
+	assert.NoError(err)
+	assert.Equal("10.0.0.100", ip.String())
+
+	exists, err := balancers.TCPLoadBalancerExists("frontend", "")
+	assert.NoError(err)
+	assert.True(exists)
+
+	assert.NoError(balancers.UpdateTCPLoadBalancer("frontend", "", []string{"10.0.0.3"}))
+	data, err := ioutil.ReadFile(lb.(*haproxyBackend).path("frontend", ""))
+	assert.NoError(err)
+	assert.True(strings.Contains(string(data), "bind 10.0.0.100:80"))
+	assert.True(strings.Contains(string(data), "balance source"), "updates keep the affinity")
+	assert.True(strings.Contains(string(data), "server 10.0.0.3 10.0.0.3:80 check"))
+	assert.False(strings.Contains(string(data), "10.0.0.1:80"))
+
+	ip, err = balancers.CreateTCPLoadBalancer("other", "", net.ParseIP("10.0.0.200"), 443, nil, api.AffinityTypeNone)
+	assert.NoError(err)
+	assert.Equal("10.0.0.200", ip.String())
+	data, err = ioutil.ReadFile(lb.(*haproxyBackend).path("other", ""))
+	assert.NoError(err)
+	assert.True(strings.Contains(string(data), "balance roundrobin"))
+
+	assert.NoError(balancers.DeleteTCPLoadBalancer("frontend", ""))
+	exists, err = balancers.TCPLoadBalancerExists("frontend", "")
+	assert.NoError(err)
+	assert.False(exists)
+	assert.Error(balancers.UpdateTCPLoadBalancer("frontend", "", nil))
+}
+
+func TestHAProxyId(t *testing.T) {
+	assert := assert.New(t)
+	// names that only differ in characters that are unsafe for haproxy
+	assert.NotEqual(haproxyId("my.svc", ""), haproxyId("my_svc", ""))
+	assert.NotEqual(haproxyId("my/svc", ""), haproxyId("my_svc", ""))
+	assert.NotEqual(haproxyId("b-c", "a"), haproxyId("c", "a-b"))
+	assert.Equal(haproxyId("frontend", "us"), haproxyId("frontend", "us"))
+	assert.False(unsafeNameChars.MatchString(haproxyId("my svc/1", "us east")))
+}
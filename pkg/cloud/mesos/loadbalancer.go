@@ -0,0 +1,111 @@
+package mesos
+
+import (
+	"fmt"
+	"net"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// LoadBalancer describes a TCP load balancer that forwards a port to a set of
+// hosts, on the same port.
+type LoadBalancer struct {
+	Name       string           `json:"name"`
+	Region     string           `json:"region"`
+	ExternalIP net.IP           `json:"externalIP"`
+	Port       int              `json:"port"`
+	Hosts      []string         `json:"hosts"`
+	Affinity   api.AffinityType `json:"affinity,omitempty"` // ClientIP sends each client to the same host
+}
+
+// LoadBalancerBackend stores the configuration of TCP load balancers for
+// whatever balancer implementation serves them.
+type LoadBalancerBackend interface {
+	// Get returns the named load balancer, if it exists.
+	Get(name, region string) (*LoadBalancer, bool, error)
+	// Put creates or replaces a load balancer.
+	Put(lb *LoadBalancer) error
+	// Delete removes a load balancer; it's not an error if it doesn't exist.
+	Delete(name, region string) error
+}
+
+// LoadBalancerBackendFactory creates a load balancer backend from the cloud config.
+type LoadBalancerBackendFactory func(config *Config) (LoadBalancerBackend, error)
+
+var (
+	lbBackendsLock sync.Mutex
+	lbBackends     = map[string]LoadBalancerBackendFactory{}
+)
+
+// RegisterLoadBalancerBackend makes a load balancer backend available by name
+// to the loadbalancer section of the cloud config.
+func RegisterLoadBalancerBackend(name string, factory LoadBalancerBackendFactory) {
+	lbBackendsLock.Lock()
+	defer lbBackendsLock.Unlock()
+	if _, found := lbBackends[name]; found {
+		panic(fmt.Sprintf("load balancer backend %q was registered twice", name))
+	}
+	lbBackends[name] = factory
+}
+
+// newLoadBalancerBackend creates the load balancer backend named by the cloud
+// config, or returns nil if none is.
+func newLoadBalancerBackend(config *Config) (LoadBalancerBackend, error) {
+	name := config.LoadBalancer.Backend
+	if name == "" {
+		return nil, nil
+	}
+	lbBackendsLock.Lock()
+	factory, found := lbBackends[name]
+	lbBackendsLock.Unlock()
+	if !found {
+		return nil, fmt.Errorf("unknown load balancer backend %q", name)
+	}
+	return factory(config)
+}
+
+// TCPLoadBalancerExists returns whether the specified load balancer exists.
+func (c *MesosCloud) TCPLoadBalancerExists(name, region string) (bool, error) {
+	_, found, err := c.lb.Get(name, region)
+	return found, err
+}
+
+// CreateTCPLoadBalancer creates a new tcp load balancer. Returns the IP address of the balancer.
+func (c *MesosCloud) CreateTCPLoadBalancer(name, region string, externalIP net.IP, port int, hosts []string, affinityType api.AffinityType) (net.IP, error) {
+	if externalIP == nil {
+		if externalIP = net.ParseIP(c.config.LoadBalancer.Address); externalIP == nil {
+			return nil, fmt.Errorf("load balancer %v requires an external IP, none is configured", name)
+		}
+	}
+	lb := &LoadBalancer{
+		Name:       name,
+		Region:     region,
+		ExternalIP: externalIP,
+		Port:       port,
+		Hosts:      hosts,
+		Affinity:   affinityType,
+	}
+	if err := c.lb.Put(lb); err != nil {
+		return nil, err
+	}
+	return externalIP, nil
+}
+
+// UpdateTCPLoadBalancer updates hosts under the specified load balancer.
+func (c *MesosCloud) UpdateTCPLoadBalancer(name, region string, hosts []string) error {
+	lb, found, err := c.lb.Get(name, region)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("load balancer %v not found in region %v", name, region)
+	}
+	lb.Hosts = hosts
+	return c.lb.Put(lb)
+}
+
+// DeleteTCPLoadBalancer deletes a specified load balancer.
+func (c *MesosCloud) DeleteTCPLoadBalancer(name, region string) error {
+	return c.lb.Delete(name, region)
+}
@@ -3,42 +3,94 @@ package mesos
 import (
 	"errors"
 	"flag"
+	"fmt"
 	"io"
+	"math"
 	"net"
+	"os"
+	"regexp"
+	"time"
 
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/cloudprovider"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util"
 	log "github.com/golang/glog"
 	"golang.org/x/net/context"
 )
 
+const (
+	bytesPerMB = 1024 * 1024
+
+	// the name of clusters whose masters don't report one
+	defaultClusterName = "mesos"
+
+	// resources of mesos slaves, by the names that k8s schedulers use for them
+	resourceCPU    api.ResourceName = "cpu"    // millicores
+	resourceMemory api.ResourceName = "memory" // bytes
+	resourceDisk   api.ResourceName = "disk"   // bytes
+	resourcePorts  api.ResourceName = "ports"  // ranges, ex: [31000-32000]
+)
+
 var (
 	noHostNameSpecified = errors.New("No hostname specified")
 
-	//TODO(jdef) this should handle mesos upid's (perhaps once we move to pure bindings)
-	mesosMaster = flag.String("mesos_master", "localhost:5050", "Location of leading Mesos master. Default localhost:5050.")
+	listAllSlaves  = flag.Bool("list_all_mesos_slaves", false, "If true, every Mesos slave is a cloud instance, rather than only the slaves running the kubelet-executor.")
+	authPrincipal  = flag.String("mesos_authentication_principal", "", "Mesos authentication principal.")
+	authSecretFile = flag.String("mesos_authentication_secret_file", "", "Mesos authentication secret file.")
+	mesosMaster    = flag.String("mesos_master", "localhost:5050", "Location of the Mesos masters: a zk://host1:port1,host2:port2/path URL, or a comma separated list of host:port, each optionally prefixed by https:// (the scheduler requires a single master or a zk:// URL). Default localhost:5050.")
 )
 
 func init() {
 	cloudprovider.RegisterCloudProvider(
 		"mesos",
 		func(conf io.Reader) (cloudprovider.Interface, error) {
-			return newMesosCloud()
+			config, err := readConfig(conf)
+			if err != nil {
+				return nil, err
+			}
+			return newMesosCloud(config)
 		})
 }
 
 type MesosCloud struct {
 	client *mesosClient
+	config *Config
+	lb     LoadBalancerBackend // nil unless configured
 }
 
 func MasterURI() string {
 	return *mesosMaster
 }
 
-func newMesosCloud() (*MesosCloud, error) {
-	return &MesosCloud{
-		client: newMesosClient(),
-	}, nil
+// AuthenticationPrincipal returns the principal that frameworks and cloud
+// providers authenticate to Mesos with, if any.
+func AuthenticationPrincipal() string {
+	return *authPrincipal
+}
+
+// AuthenticationSecretFile returns the file containing the secret of the
+// AuthenticationPrincipal.
+func AuthenticationSecretFile() string {
+	return *authSecretFile
+}
+
+func newMesosCloud(config *Config) (*MesosCloud, error) {
+	if config.Mesos.Masters == "" {
+		config.Mesos.Masters = MasterURI()
+	}
+	if config.Mesos.Principal == "" {
+		config.Mesos.Principal = AuthenticationPrincipal()
+		config.Mesos.SecretFile = AuthenticationSecretFile()
+	}
+	client, err := newMesosClient(config)
+	if err != nil {
+		return nil, err
+	}
+	lb, err := newLoadBalancerBackend(config)
+	if err != nil {
+		return nil, err
+	}
+	return &MesosCloud{client: client, config: config, lb: lb}, nil
 }
 
 // Mesos natively provides minimal cloud-type resources. More robust cloud
@@ -48,69 +100,242 @@ func (c *MesosCloud) Instances() (cloudprovider.Instances, bool) {
 	return c, true
 }
 
-// Mesos does not provide any type of native load balancing by default,
-// so this implementation always returns (nil,false).
+// Mesos does not provide any type of native load balancing by default, so
+// balancers are written to the load balancer backend named by the cloud
+// config. Returns (nil,false) if there isn't one.
 func (c *MesosCloud) TCPLoadBalancer() (cloudprovider.TCPLoadBalancer, bool) {
-	return nil, false
+	if c.lb == nil {
+		return nil, false
+	}
+	return c, true
 }
 
-// Mesos does not provide any type of native region or zone awareness,
-// so this implementation always returns (nil,false).
+// Mesos does not provide any type of native region or zone awareness, so zones
+// are derived from slave attributes. Returns (nil,false) unless the cloud config
+// names the attribute that identifies the failure domain of a slave.
 func (c *MesosCloud) Zones() (cloudprovider.Zones, bool) {
-	return nil, false
+	if c.config.Zones.FailureDomainAttribute == "" {
+		return nil, false
+	}
+	return c, true
+}
+
+// GetZone returns the zone of the slave running on this host. It only works on
+// hosts that run a Mesos slave, such as the executor's; elsewhere, like on the
+// scheduler or controller-manager hosts, it returns an InstanceNotFoundError.
+// Components that know which slave they're interested in should use
+// ZoneForSlave instead.
+func (c *MesosCloud) GetZone() (cloudprovider.Zone, error) {
+	hostname, err := os.Hostname()
+	if err != nil {
+		return cloudprovider.Zone{}, err
+	}
+	return c.ZoneForSlave(hostname)
+}
+
+// ZoneForSlave returns the zone of the slave with the given host name, as
+// determined by the zone attributes of the cloud config.
+func (c *MesosCloud) ZoneForSlave(name string) (cloudprovider.Zone, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	slave, found, err := c.client.Slave(ctx, name)
+	if err != nil {
+		return cloudprovider.Zone{}, err
+	}
+	if !found {
+		return cloudprovider.Zone{}, &InstanceNotFoundError{name}
+	}
+	zone := cloudprovider.Zone{}
+	if zone.FailureDomain, found = slave.attribute(c.config.Zones.FailureDomainAttribute); !found {
+		return cloudprovider.Zone{}, fmt.Errorf("Mesos slave '%v' has no attribute '%v'", name, c.config.Zones.FailureDomainAttribute)
+	}
+	if attr := c.config.Zones.RegionAttribute; attr != "" {
+		zone.Region, _ = slave.attribute(attr)
+	}
+	return zone, nil
 }
 
-// Mesos does not provide support for multiple clusters
+// Mesos does not provide support for multiple clusters, so the only cluster
+// is the one managed by the leading master.
 func (c *MesosCloud) Clusters() (cloudprovider.Clusters, bool) {
-	//TODO(jdef): we could probably implement this and always return a
-	//single cluster- this one.
-	return nil, false
+	return c, true
+}
+
+// ListClusters returns the name of the Mesos cluster.
+func (c *MesosCloud) ListClusters() ([]string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	name, err := c.clusterName(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return []string{name}, nil
 }
 
-// IPAddress returns an IP address of the specified instance.
+// Master returns the host:port of the leading master of the named cluster.
+func (c *MesosCloud) Master(clusterName string) (string, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	name, err := c.clusterName(ctx)
+	if err != nil {
+		return "", err
+	}
+	if clusterName != name {
+		return "", fmt.Errorf("Unknown cluster '%v'", clusterName)
+	}
+	return c.client.leadingMaster(ctx)
+}
+
+// clusterName returns the name of the Mesos cluster, or defaultClusterName if
+// the masters don't know it.
+func (c *MesosCloud) clusterName(ctx context.Context) (string, error) {
+	name, err := c.client.ClusterName(ctx)
+	if err != nil {
+		return "", err
+	}
+	if name == "" {
+		name = defaultClusterName
+	}
+	return name, nil
+}
+
+// InstanceNotFoundError is returned when a name doesn't identify a known slave.
+type InstanceNotFoundError struct {
+	Name string
+}
+
+func (e *InstanceNotFoundError) Error() string {
+	return fmt.Sprintf("No Mesos slave found with host name '%v'", e.Name)
+}
+
+// IPAddress returns an IP address of the specified instance: the IP of the
+// slave's pid as reported by Mesos. DNS is only consulted if the cloud config
+// enables dns-fallback, for slaves that Mesos doesn't know about or whose pid
+// doesn't carry an IP.
 func (c *MesosCloud) IPAddress(name string) (net.IP, error) {
 	if name == "" {
 		return nil, noHostNameSpecified
 	}
-	// TODO(jdef): validate that name actually points to a slave that we know
-	if iplist, err := net.LookupIP(name); err != nil {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	slave, found, err := c.client.Slave(ctx, name)
+	if err != nil {
+		if c.config.Slaves.DnsFallback {
+			log.Warningf("Failed to look up slave '%v', falling back to DNS: %v", name, err)
+			return lookupIP(name)
+		}
+		return nil, err
+	}
+	if !found {
+		if c.config.Slaves.DnsFallback {
+			return lookupIP(name)
+		}
+		return nil, &InstanceNotFoundError{name}
+	}
+	if hostPort, err := parseUPID(slave.Pid); err == nil {
+		if host, _, err := net.SplitHostPort(hostPort); err == nil {
+			if ip := net.ParseIP(host); ip != nil {
+				log.V(2).Infof("Resolved host '%v' to '%v' from slave pid", name, ip)
+				return ip, nil
+			}
+		}
+	}
+	if c.config.Slaves.DnsFallback {
+		return lookupIP(name)
+	}
+	return nil, fmt.Errorf("Mesos slave '%v' has no IP address in its pid '%v'", name, slave.Pid)
+}
+
+func lookupIP(name string) (net.IP, error) {
+	iplist, err := net.LookupIP(name)
+	if err != nil {
 		log.Warningf("Failed to resolve IP from host name '%v': %v", name, err)
 		return nil, err
-	} else {
-		ipaddr := iplist[0]
-		log.V(2).Infof("Resolved host '%v' to '%v'", name, ipaddr)
-		return ipaddr, nil
 	}
+	ipaddr := iplist[0]
+	log.V(2).Infof("Resolved host '%v' to '%v'", name, ipaddr)
+	return ipaddr, nil
 }
 
 // List lists instances that match 'filter' which is a regular expression
-// which must match the entire instance name (fqdn).
+// which must match the entire instance name (fqdn). Only slaves running the
+// kubelet-executor are instances, unless -list_all_mesos_slaves is set.
 func (c *MesosCloud) List(filter string) ([]string, error) {
+	var re *regexp.Regexp
+	if filter != "" {
+		var err error
+		if re, err = regexp.Compile("^(?:" + filter + ")$"); err != nil {
+			return nil, err
+		}
+	}
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
-	// TODO(jdef) listing all slaves for now, until EnlistedSlaves scales better
-	// Because of this, minion health checks should be disabled on the apiserver
-	addr, err := c.client.EnumerateSlaves(ctx)
-	if err == nil {
-		if len(addr) == 0 {
-			log.V(2).Info("no slaves found, are any running?")
+
+	var hosts []string
+	var err error
+	if *listAllSlaves {
+		// Because of this, minion health checks should be disabled on the apiserver
+		addr, err := c.client.EnumerateSlaves(ctx)
+		if err != nil {
+			log.Warning(err)
+		}
+		for _, a := range addr {
+			host, _, err := net.SplitHostPort(a)
+			if err != nil {
+				log.Warning(err)
+				continue
+			}
+			hosts = append(hosts, host)
 		}
-	} else {
+	} else if hosts, err = c.client.EnlistedSlaves(ctx); err != nil {
 		log.Warning(err)
 	}
+	if len(hosts) == 0 {
+		log.V(2).Info("no slaves found, are any running?")
+	}
+
 	slaves := []string{}
-	for _, a := range addr {
-		host, _, err := net.SplitHostPort(a)
-		if err != nil {
-			log.Warning(err)
-			continue
+	for _, host := range hosts {
+		if re == nil || re.MatchString(host) {
+			slaves = append(slaves, host)
 		}
-		slaves = append(slaves, host)
 	}
 	return slaves, nil
 }
 
-// GetNodeResources gets the resources for a particular node
+// StateAge returns the time since the state of the mesos master was last fetched,
+// or false if it never was. Instances are looked up in that state, which is kept
+// while the master can't be reached.
+func (c *MesosCloud) StateAge() (time.Duration, bool) {
+	return c.client.StateAge()
+}
+
+// GetNodeResources gets the resources for a particular node: the total cpus,
+// memory, disk and ports that the slave offers to Mesos frameworks.
 func (c *MesosCloud) GetNodeResources(name string) (*api.NodeResources, error) {
-	return nil, nil
+	if name == "" {
+		return nil, noHostNameSpecified
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	slave, found, err := c.client.Slave(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return nil, &InstanceNotFoundError{name}
+	}
+	return makeNodeResources(slave.Resources), nil
+}
+
+func makeNodeResources(r slaveResources) *api.NodeResources {
+	capacity := api.ResourceList{
+		resourceCPU:    util.NewIntOrStringFromInt(int(math.Floor(r.Cpus*1000 + 0.5))),
+		resourceMemory: util.NewIntOrStringFromInt(int(math.Floor(r.Mem*bytesPerMB + 0.5))),
+		resourceDisk:   util.NewIntOrStringFromInt(int(math.Floor(r.Disk*bytesPerMB + 0.5))),
+	}
+	if r.Ports != "" {
+		capacity[resourcePorts] = util.NewIntOrStringFromString(r.Ports)
+	}
+	return &api.NodeResources{Capacity: capacity}
 }
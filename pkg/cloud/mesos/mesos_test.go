@@ -0,0 +1,346 @@
+package mesos
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	kmconfig "github.com/mesosphere/kubernetes-mesos/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/net/context"
+)
+
+const testState = `{
+	"cluster": "test",
+	"leader": "master@%s",
+	"slaves": [{
+		"id": "20150106-162714-3815890698-5050-2453-S2",
+		"pid": "slave(1)@10.22.211.18:5051",
+		"hostname": "slave1.example.com",
+		"resources": {"cpus": 4, "mem": 1024, "disk": 2048, "ports": "[31000-32000]"},
+		"attributes": {"rack": "r12", "dc": "east"}
+	}, {
+		"id": "20150106-162714-3815890698-5050-2453-S3",
+		"pid": "slave(1)@10.22.211.19:5051",
+		"hostname": "slave2.example.com"
+	}],
+	"frameworks": [{
+		"id": "20150106-162714-3815890698-5050-2453-0000",
+		"name": "KubernetesScheduler",
+		"executors": [{
+			"executor_id": "KubeleteExecutorID",
+			"slave_id": "20150106-162714-3815890698-5050-2453-S2",
+			"source": "kubernetes"
+		}]
+	}, {
+		"id": "20150106-162714-3815890698-5050-2453-0001",
+		"name": "marathon",
+		"executors": [{
+			"executor_id": "KubeleteExecutorID",
+			"slave_id": "20150106-162714-3815890698-5050-2453-S3",
+			"source": "kubernetes"
+		}]
+	}]
+}`
+
+// newTestCloud returns a cloud backed by a fake master serving testState
+func newTestCloud(t *testing.T) (*MesosCloud, *httptest.Server) {
+	var addr string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		fmt.Fprintf(w, testState, addr)
+	}))
+	addr = strings.TrimPrefix(srv.URL, "http://")
+	config := testConfig(addr)
+	client, err := newMesosClient(config)
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+	return &MesosCloud{client: client, config: config}, srv
+}
+
+func TestGetNodeResources(t *testing.T) {
+	assert := assert.New(t)
+	cloud, srv := newTestCloud(t)
+	defer srv.Close()
+
+	for _, name := range []string{"slave1.example.com", "10.22.211.18"} {
+		resources, err := cloud.GetNodeResources(name)
+		assert.NoError(err)
+		if assert.NotNil(resources) {
+			cpu := resources.Capacity[resourceCPU]
+			mem := resources.Capacity[resourceMemory]
+			ports := resources.Capacity[resourcePorts]
+			assert.Equal(4000, cpu.IntVal)
+			assert.Equal(1024*bytesPerMB, mem.IntVal)
+			assert.Equal("[31000-32000]", ports.StrVal)
+		}
+	}
+
+	_, err := cloud.GetNodeResources("unknown")
+	assert.Error(err)
+}
+
+func TestMakeNodeResources_Rounding(t *testing.T) {
+	assert := assert.New(t)
+	// 1.001 and 2.002 cpus are slightly less in binary, and used to be truncated
+	for cpus, expected := range map[float64]int{0.57: 570, 1.001: 1001, 2.002: 2002, 4: 4000} {
+		resources := makeNodeResources(slaveResources{Cpus: cpus, Mem: 0.5})
+		cpu := resources.Capacity[resourceCPU]
+		mem := resources.Capacity[resourceMemory]
+		assert.Equal(expected, cpu.IntVal, "%v cpus", cpus)
+		assert.Equal(bytesPerMB/2, mem.IntVal)
+	}
+}
+
+func TestZones(t *testing.T) {
+	assert := assert.New(t)
+	cloud, srv := newTestCloud(t)
+	defer srv.Close()
+
+	_, supported := cloud.Zones()
+	assert.False(supported)
+
+	config, err := readConfig(strings.NewReader("[zones]\nfailure-domain-attribute = rack\nregion-attribute = dc\n"))
+	assert.NoError(err)
+	cloud.config = config
+	_, supported = cloud.Zones()
+	assert.True(supported)
+
+	zone, err := cloud.ZoneForSlave("slave1.example.com")
+	assert.NoError(err)
+	assert.Equal("r12", zone.FailureDomain)
+	assert.Equal("east", zone.Region)
+
+	cloud.config.Zones.FailureDomainAttribute = "zone"
+	_, err = cloud.ZoneForSlave("slave1.example.com")
+	assert.Error(err)
+}
+
+func TestReadConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	config, err := readConfig(nil)
+	if err != nil {
+		t.Fatalf("failed to read empty config: %v", err)
+	}
+	timeout, _ := config.httpTimeout()
+	assert.Equal(DefaultHttpTimeout, timeout)
+
+	config, err = readConfig(strings.NewReader(`
+[mesos]
+masters = 10.0.0.1:5050,10.0.0.2:5050
+http-timeout = 3s
+[slaves]
+attribute = rack:r12
+hostname-pattern = "^slave[0-9]+\\.example\\.com$"
+`))
+	if err != nil {
+		t.Fatalf("failed to read config: %v", err)
+	}
+	assert.Equal("10.0.0.1:5050,10.0.0.2:5050", config.Mesos.Masters)
+	timeout, _ = config.httpTimeout()
+	assert.Equal(3*time.Second, timeout)
+
+	filter, err := config.slaveFilter()
+	if err != nil {
+		t.Fatalf("failed to create slave filter: %v", err)
+	}
+	slave := &slaveState{Hostname: "slave1.example.com", Attributes: map[string]interface{}{"rack": "r12"}}
+	assert.True(filter.matches(slave))
+	slave.Attributes["rack"] = "r13"
+	assert.False(filter.matches(slave))
+
+	_, err = readConfig(strings.NewReader("[mesos]\nhttp-timeout = soon\n"))
+	assert.Error(err)
+	_, err = readConfig(strings.NewReader("[slaves]\nattribute = rack\n"))
+	assert.Error(err)
+}
+
+// newSlaveServer returns a fake slave, running the k8sm executor if enlisted
+func newSlaveServer(enlisted bool) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if enlisted {
+			fmt.Fprintf(w, `{"frameworks":[{"name":%q,"executors":[{"id":%q,"source":%q}]}]}`,
+				kmconfig.DefaultFrameworkName, kmconfig.DefaultInfoID, kmconfig.DefaultInfoSource)
+		} else {
+			fmt.Fprint(w, `{"frameworks":[]}`)
+		}
+	}))
+}
+
+func TestMesosClient_StateCache(t *testing.T) {
+	assert := assert.New(t)
+
+	slaves := []*httptest.Server{newSlaveServer(true), newSlaveServer(false), newSlaveServer(true)}
+	pids := []string{}
+	for _, s := range slaves {
+		defer s.Close()
+		pids = append(pids, fmt.Sprintf(`{"pid":"slave(1)@%s"}`, strings.TrimPrefix(s.URL, "http://")))
+	}
+	requests := 0
+	master := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		requests++
+		assert.Equal("/master/slaves", req.URL.Path)
+		fmt.Fprintf(w, `{"slaves":[%s]}`, strings.Join(pids, ","))
+	}))
+	defer master.Close()
+
+	config := testConfig(strings.TrimPrefix(master.URL, "http://"))
+	config.Mesos.SlavesEndpoint = true
+	config.Mesos.SlaveProbeWorkers = 2
+	config.Mesos.StateRefreshInterval = "1h"
+	client, err := newMesosClient(config)
+	assert.NoError(err)
+	// the master is asked for its state by name, skip leader detection
+	client.leader = strings.TrimPrefix(master.URL, "http://")
+
+	_, known := client.StateAge()
+	assert.False(known)
+
+	hosts, err := client.EnlistedSlaves(context.Background())
+	assert.NoError(err)
+	assert.Equal(2, len(hosts))
+
+	hosts, err = client.EnlistedSlaves(context.Background())
+	assert.NoError(err)
+	assert.Equal(2, len(hosts))
+	assert.Equal(1, requests)
+
+	age, known := client.StateAge()
+	assert.True(known)
+	assert.True(age < time.Hour)
+}
+
+func TestMesosClient_StateRefresh(t *testing.T) {
+	assert := assert.New(t)
+
+	var lock sync.Mutex
+	requests := 0
+	fail := false
+	block := make(chan struct{})
+	blocked := make(chan struct{}, 1)
+	master := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		lock.Lock()
+		requests++
+		n, failing := requests, fail
+		lock.Unlock()
+		if n == 2 {
+			// hold the first refresh until the test releases it
+			blocked <- struct{}{}
+			<-block
+		}
+		if failing {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, `{"slaves":[{"pid":"slave(1)@10.0.0.1:5051","hostname":"slave1"}]}`)
+	}))
+	defer master.Close()
+
+	config := testConfig(strings.TrimPrefix(master.URL, "http://"))
+	config.Mesos.SlavesEndpoint = true
+	client, err := newMesosClient(config)
+	assert.NoError(err)
+	client.leader = strings.TrimPrefix(master.URL, "http://")
+	client.stateRefresh = 0 // refresh on every lookup
+
+	state, err := client.state(context.Background())
+	assert.NoError(err)
+	assert.Equal(1, len(state.Slaves))
+
+	// lookups during a refresh get the stale state instead of waiting for it
+	refreshed := make(chan error)
+	go func() {
+		_, err := client.state(context.Background())
+		refreshed <- err
+	}()
+	<-blocked
+	state, err = client.state(context.Background())
+	assert.NoError(err)
+	assert.Equal(1, len(state.Slaves))
+	_, known := client.StateAge()
+	assert.True(known)
+	close(block)
+	assert.NoError(<-refreshed)
+
+	// when the master fails the stale state is served, and ages
+	lock.Lock()
+	fail = true
+	lock.Unlock()
+	age, _ := client.StateAge()
+	time.Sleep(10 * time.Millisecond)
+	state, err = client.state(context.Background())
+	assert.NoError(err)
+	assert.Equal(1, len(state.Slaves))
+	stale, known := client.StateAge()
+	assert.True(known)
+	assert.True(stale > age)
+
+	cloud := &MesosCloud{client: client, config: config}
+	_, known = cloud.StateAge()
+	assert.True(known)
+}
+
+func TestList(t *testing.T) {
+	assert := assert.New(t)
+	cloud, srv := newTestCloud(t)
+	defer srv.Close()
+
+	slaves, err := cloud.List("")
+	assert.NoError(err)
+	assert.Equal([]string{"10.22.211.18"}, slaves)
+
+	slaves, err = cloud.List("10\\.22\\..*")
+	assert.NoError(err)
+	assert.Equal([]string{"10.22.211.18"}, slaves)
+
+	slaves, err = cloud.List("10\\.22")
+	assert.NoError(err)
+	assert.Equal(0, len(slaves))
+
+	*listAllSlaves = true
+	defer func() { *listAllSlaves = false }()
+	slaves, err = cloud.List("")
+	assert.NoError(err)
+	assert.Equal([]string{"10.22.211.18", "10.22.211.19"}, slaves)
+}
+
+func TestIPAddress(t *testing.T) {
+	assert := assert.New(t)
+	cloud, srv := newTestCloud(t)
+	defer srv.Close()
+
+	ip, err := cloud.IPAddress("slave1.example.com")
+	assert.NoError(err)
+	assert.Equal("10.22.211.18", ip.String())
+
+	_, err = cloud.IPAddress("unknown.example.com")
+	_, notFound := err.(*InstanceNotFoundError)
+	assert.True(notFound)
+
+	cloud.config.Slaves.DnsFallback = true
+	ip, err = cloud.IPAddress("127.0.0.1")
+	assert.NoError(err)
+	assert.Equal("127.0.0.1", ip.String())
+}
+
+func TestClusters(t *testing.T) {
+	assert := assert.New(t)
+	cloud, srv := newTestCloud(t)
+	defer srv.Close()
+
+	names, err := cloud.ListClusters()
+	assert.NoError(err)
+	assert.Equal([]string{"test"}, names)
+
+	master, err := cloud.Master("test")
+	assert.NoError(err)
+	assert.Equal(strings.TrimPrefix(srv.URL, "http://"), master)
+
+	_, err = cloud.Master("other")
+	assert.Error(err)
+}
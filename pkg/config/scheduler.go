@@ -0,0 +1,6 @@
+package config
+
+// default values to use when constructing mesos FrameworkInfo messages
+const (
+	DefaultFrameworkName = "KubernetesScheduler"
+)
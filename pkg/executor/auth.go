@@ -0,0 +1,119 @@
+package executor
+
+import (
+	"crypto/x509"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// AuthConfig configures TLS, authentication and authorization of the executor's
+// kubelet server. Authentication is enabled when either ClientCAFile or TokenFile
+// is set, in which case every endpoint other than /healthz requires an identity
+// and the debugging endpoints require an admin identity.
+type AuthConfig struct {
+	TLSCertFile  string   // serve HTTPS with this certificate when set
+	TLSKeyFile   string   // private key of TLSCertFile
+	ClientCAFile string   // authenticate clients presenting certificates signed by these CAs
+	TokenFile    string   // authenticate clients presenting bearer tokens listed in this file
+	AdminUsers   []string // identities allowed to use the debugging endpoints
+}
+
+// identifies the clients of the kubelet server
+type authenticator struct {
+	clientCAs *x509.CertPool
+	tokens    map[string]string // bearer token => user
+	admins    map[string]bool
+}
+
+// returns nil if authentication isn't configured
+func newAuthenticator(config AuthConfig) (*authenticator, error) {
+	if config.ClientCAFile == "" && config.TokenFile == "" {
+		return nil, nil
+	}
+	if config.ClientCAFile != "" && config.TLSCertFile == "" {
+		return nil, fmt.Errorf("client certificate authentication requires a TLS certificate")
+	}
+	if config.TokenFile != "" && config.TLSCertFile == "" {
+		// bearer tokens would travel in cleartext
+		return nil, fmt.Errorf("token authentication requires a TLS certificate")
+	}
+	a := &authenticator{
+		tokens: map[string]string{},
+		admins: map[string]bool{},
+	}
+	if config.ClientCAFile != "" {
+		pem, err := ioutil.ReadFile(config.ClientCAFile)
+		if err != nil {
+			return nil, err
+		}
+		a.clientCAs = x509.NewCertPool()
+		if !a.clientCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in client CA file %q", config.ClientCAFile)
+		}
+	}
+	if config.TokenFile != "" {
+		tokens, err := readTokenFile(config.TokenFile)
+		if err != nil {
+			return nil, err
+		}
+		a.tokens = tokens
+	}
+	for _, user := range config.AdminUsers {
+		a.admins[user] = true
+	}
+	return a, nil
+}
+
+// reads a CSV file with lines of the form: token,user[,...] -- the same format
+// that the k8s apiserver accepts for -token_auth_file
+func readTokenFile(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	tokens := map[string]string{}
+	reader := csv.NewReader(f)
+	reader.FieldsPerRecord = -1
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		if len(record) < 2 || record[0] == "" || record[1] == "" {
+			return nil, fmt.Errorf("invalid line in token file %q: expected token,user", path)
+		}
+		tokens[record[0]] = record[1]
+	}
+	return tokens, nil
+}
+
+// returns the identity of the client that issued the request, if any. Client
+// certificates are only trusted when client CAs are configured.
+func (a *authenticator) authenticate(req *http.Request) (string, bool) {
+	if a.clientCAs != nil && req.TLS != nil && len(req.TLS.VerifiedChains) > 0 && len(req.TLS.PeerCertificates) > 0 {
+		if user := req.TLS.PeerCertificates[0].Subject.CommonName; user != "" {
+			return user, true
+		}
+	}
+	if auth := req.Header.Get("Authorization"); strings.HasPrefix(auth, "Bearer ") {
+		token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		if user, found := a.tokens[token]; found {
+			return user, true
+		}
+	}
+	return "", false
+}
+
+func (a *authenticator) isAdmin(user string) bool {
+	return a.admins[user]
+}
@@ -0,0 +1,162 @@
+package executor
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func writeTokenFile(t *testing.T, content string) string {
+	f, err := ioutil.TempFile("", "k8sm-tokens")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := f.WriteString(content); err != nil {
+		t.Fatal(err)
+	}
+	return f.Name()
+}
+
+func TestReadTokenFile(t *testing.T) {
+	assert := assert.New(t)
+	path := writeTokenFile(t, "abc123,alice\ndef456,bob,uid,group\n")
+	defer os.Remove(path)
+
+	tokens, err := readTokenFile(path)
+	assert.NoError(err)
+	assert.Equal(map[string]string{"abc123": "alice", "def456": "bob"}, tokens)
+
+	for _, invalid := range []string{"abc123\n", ",alice\n", "abc123,\n", "\"unterminated,alice\n"} {
+		path := writeTokenFile(t, invalid)
+		_, err := readTokenFile(path)
+		assert.Error(err, invalid)
+		os.Remove(path)
+	}
+
+	_, err = readTokenFile("/nonexistent/tokens.csv")
+	assert.Error(err)
+}
+
+func TestNewAuthenticator_RequiresTLS(t *testing.T) {
+	assert := assert.New(t)
+	path := writeTokenFile(t, "abc123,alice\n")
+	defer os.Remove(path)
+
+	a, err := newAuthenticator(AuthConfig{})
+	assert.NoError(err)
+	assert.Nil(a)
+
+	_, err = newAuthenticator(AuthConfig{TokenFile: path})
+	if assert.Error(err) {
+		assert.Equal("token authentication requires a TLS certificate", err.Error())
+	}
+	_, err = newAuthenticator(AuthConfig{ClientCAFile: path})
+	if assert.Error(err) {
+		assert.Equal("client certificate authentication requires a TLS certificate", err.Error())
+	}
+
+	a, err = newAuthenticator(AuthConfig{TLSCertFile: "server.crt", TokenFile: path})
+	assert.NoError(err)
+	if assert.NotNil(a) {
+		assert.Equal(map[string]string{"abc123": "alice"}, a.tokens)
+	}
+}
+
+// returns a request from a client that presented a certificate for the given user,
+// as if the TLS layer had verified it
+func certRequest(user string) *http.Request {
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: user}}
+	req, _ := http.NewRequest("GET", "https://localhost/podInfo", nil)
+	req.TLS = &tls.ConnectionState{
+		PeerCertificates: []*x509.Certificate{cert},
+		VerifiedChains:   [][]*x509.Certificate{{cert}},
+	}
+	return req
+}
+
+func tokenRequest(token string) *http.Request {
+	req, _ := http.NewRequest("GET", "http://localhost/podInfo", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	return req
+}
+
+func TestAuthenticate(t *testing.T) {
+	assert := assert.New(t)
+	a := &authenticator{tokens: map[string]string{"abc123": "alice"}}
+
+	user, ok := a.authenticate(tokenRequest("abc123"))
+	assert.True(ok)
+	assert.Equal("alice", user)
+
+	_, ok = a.authenticate(tokenRequest("wrong"))
+	assert.False(ok)
+
+	req, _ := http.NewRequest("GET", "http://localhost/podInfo", nil)
+	_, ok = a.authenticate(req)
+	assert.False(ok)
+
+	// without client CAs, certificates verified against the system roots don't count
+	_, ok = a.authenticate(certRequest("admin"))
+	assert.False(ok)
+
+	a.clientCAs = x509.NewCertPool()
+	user, ok = a.authenticate(certRequest("admin"))
+	assert.True(ok)
+	assert.Equal("admin", user)
+
+	// unverified certificates never count
+	req = certRequest("admin")
+	req.TLS.VerifiedChains = nil
+	_, ok = a.authenticate(req)
+	assert.False(ok)
+}
+
+func TestAuthorize(t *testing.T) {
+	s := &Server{
+		auth: &authenticator{
+			tokens: map[string]string{"admin-token": "root", "user-token": "alice"},
+			admins: map[string]bool{"root": true},
+		},
+		adminPaths: []string{"/logs/", "/drain"},
+	}
+	table := []struct {
+		path   string
+		token  string
+		status int
+	}{
+		{"/healthz", "", http.StatusOK},
+		{"/podInfo", "", http.StatusUnauthorized},
+		{"/podInfo", "bogus", http.StatusUnauthorized},
+		{"/podInfo", "user-token", http.StatusOK},
+		{"/logs/", "user-token", http.StatusForbidden},
+		{"/logs/syslog", "user-token", http.StatusForbidden},
+		{"/logs/syslog", "admin-token", http.StatusOK},
+		{"/drain", "user-token", http.StatusForbidden},
+		{"/drain", "admin-token", http.StatusOK},
+		{"/drain/foo", "user-token", http.StatusOK}, // only patterns ending in / match subpaths
+	}
+	for _, tt := range table {
+		req, _ := http.NewRequest("GET", "http://localhost"+tt.path, nil)
+		if tt.token != "" {
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+		}
+		w := httptest.NewRecorder()
+		if s.authorize(w, req) {
+			w.WriteHeader(http.StatusOK)
+		}
+		assert.Equal(t, tt.status, w.Code, "%v with token %q", tt.path, tt.token)
+	}
+
+	// authentication disabled
+	s.auth = nil
+	req, _ := http.NewRequest("GET", "http://localhost/logs/syslog", nil)
+	assert.True(t, s.authorize(httptest.NewRecorder(), req))
+}
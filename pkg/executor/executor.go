@@ -1,51 +1,107 @@
 package executor
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
+	"net"
 	"sync"
 	"time"
 
 	"code.google.com/p/goprotobuf/proto"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/watch"
 	log "github.com/golang/glog"
+	"github.com/google/cadvisor/info"
 	"github.com/mesos/mesos-go/mesos"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
 	"gopkg.in/v2/yaml"
 )
 
 const (
-	containerPollTime = 300 * time.Millisecond
-	launchGracePeriod = 5 * time.Minute
+	networkContainerName   = "net" // the kubelet's name for the pod's network container
+	containerPollTime      = 300 * time.Millisecond
+	launchGracePeriod      = 5 * time.Minute
+	drainGracePeriod       = 1 * time.Minute  // max time to wait for a pod to terminate while draining
+	DefaultRecoveryTimeout = 15 * time.Minute // mirrors the default slave --recovery_timeout
 )
 
 type kuberTask struct {
 	mesosTaskInfo *mesos.TaskInfo
 	podName       string
+	running       bool // true once TASK_RUNNING has been reported for the pod
+}
+
+// executorDriver is the subset of mesos.ExecutorDriver that the executor uses to
+// talk to the slave.
+type executorDriver interface {
+	SendStatusUpdate(*mesos.TaskStatus) error
+	SendFrameworkMessage(string) error
+}
+
+// Config holds the parameters used to construct a KubernetesExecutor.
+type Config struct {
+	Kubelet    *kubelet.Kubelet   // the kubelet instance
+	Updates    chan<- interface{} // to send pod config updates to the kubelet
+	SourceName string             // the kubelet config source annotation value
+
+	// RecoveryTimeout is how long the executor keeps its pods running after
+	// losing its connection to the slave. If the slave does not come back within
+	// this window then all pods are torn down and the executor driver is stopped.
+	// A value <= 0 waits forever.
+	RecoveryTimeout time.Duration
+
+	// AllowPrivileged permits pod containers to run in privileged mode.
+	AllowPrivileged bool
+
+	// AllowedHostPaths restricts the host paths that pods may mount as volumes
+	// to these directories and their descendants. Empty allows any host path.
+	AllowedHostPaths []string
 }
 
 // KubernetesExecutor is an mesos executor that runs pods
 // in a minion machine.
 type KubernetesExecutor struct {
-	kl         *kubelet.Kubelet // the kubelet instance.
-	updateChan chan<- interface{}
-	driver     mesos.ExecutorDriver
-	registered bool
-	tasks      map[string]*kuberTask
-	pods       map[string]*api.BoundPod
-	lock       sync.RWMutex
-	sourcename string
+	kl               *kubelet.Kubelet // the kubelet instance.
+	updateChan       chan<- interface{}
+	driver           executorDriver
+	stopDriver       func() // stops the executor driver
+	getPodInfo       func(podFullName string) (api.PodInfo, error)
+	registered       bool
+	tasks            map[string]*kuberTask
+	pods             map[string]*api.BoundPod
+	lock             sync.RWMutex
+	sourcename       string
+	recoveryTimeout  time.Duration
+	recoveryTimer    *time.Timer         // non-nil while waiting for the slave to come back
+	pendingUpdates   []*mesos.TaskStatus // status updates buffered while disconnected
+	pendingLaunches  []*mesos.TaskInfo   // tasks received while disconnected, launched upon reconnect
+	hostIP           string              // IP address of the slave, reported in pod status
+	draining         bool                // when true, new tasks are rejected
+	allowPrivileged  bool
+	allowedHostPaths []string
+	podWatch         *podBroadcaster // notified of every pod update sent to the kubelet
 }
 
 // New creates a new kubernetes executor.
-func New(driver mesos.ExecutorDriver, kl *kubelet.Kubelet, ch chan<- interface{}, ns string) *KubernetesExecutor {
+func New(driver mesos.ExecutorDriver, config Config) *KubernetesExecutor {
 	return &KubernetesExecutor{
-		kl:         kl,
-		updateChan: ch,
+		kl:         config.Kubelet,
+		updateChan: config.Updates,
 		driver:     driver,
-		registered: false,
-		tasks:      make(map[string]*kuberTask),
-		pods:       make(map[string]*api.BoundPod),
-		sourcename: ns,
+		stopDriver: func() { driver.Stop() },
+		getPodInfo: func(podFullName string) (api.PodInfo, error) {
+			return config.Kubelet.GetPodInfo(podFullName, "")
+		},
+		registered:       false,
+		tasks:            make(map[string]*kuberTask),
+		pods:             make(map[string]*api.BoundPod),
+		sourcename:       config.SourceName,
+		recoveryTimeout:  config.RecoveryTimeout,
+		allowPrivileged:  config.AllowPrivileged,
+		allowedHostPaths: config.AllowedHostPaths,
+		podWatch:         newPodBroadcaster(),
 	}
 }
 
@@ -54,35 +110,199 @@ func (k *KubernetesExecutor) Registered(driver mesos.ExecutorDriver,
 	executorInfo *mesos.ExecutorInfo, frameworkInfo *mesos.FrameworkInfo, slaveInfo *mesos.SlaveInfo) {
 	log.Infof("Executor %v of framework %v registered with slave %v\n",
 		executorInfo, frameworkInfo, slaveInfo)
-	k.registered = true
+
+	hostIP := resolveHostIP(slaveInfo.GetHostname())
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.hostIP = hostIP
+	k.reconnected()
 }
 
 // Reregistered is called when the executor is successfully re-registered with the slave.
 // This can happen when the slave fails over.
 func (k *KubernetesExecutor) Reregistered(driver mesos.ExecutorDriver, slaveInfo *mesos.SlaveInfo) {
 	log.Infof("Reregistered with slave %v\n", slaveInfo)
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.reconnected()
+}
+
+// Marks the executor as registered, advertises its capabilities, cancels any pending
+// recovery timeout, flushes the status updates that were buffered while disconnected,
+// launches the tasks received meanwhile and reconciles the state of running tasks with
+// the slave. Assumes that the caller is locking around executor state.
+func (k *KubernetesExecutor) reconnected() {
 	k.registered = true
+	k.sendCapabilities()
+	if k.draining {
+		// the scheduler may have missed a drain over HTTP while disconnected
+		k.sendDrainMode()
+	}
+	if k.recoveryTimer != nil {
+		k.recoveryTimer.Stop()
+		k.recoveryTimer = nil
+	}
+
+	pending := k.pendingUpdates
+	k.pendingUpdates = nil
+	if len(pending) > 0 {
+		log.Infof("Sending %d status update(s) buffered while disconnected", len(pending))
+	}
+	for _, status := range pending {
+		k.sendStatus(status)
+	}
+
+	launches := k.pendingLaunches
+	k.pendingLaunches = nil
+	for _, taskInfo := range launches {
+		log.Infof("Launching task %v received while disconnected", taskInfo.GetTaskId().GetValue())
+		k.launchTask(taskInfo)
+	}
+
+	tids := []string{}
+	for tid, task := range k.tasks {
+		if task.running {
+			tids = append(tids, tid)
+		}
+	}
+	if len(tids) > 0 {
+		go k.reconcileTasks(tids)
+	}
+}
+
+// Re-reports the state of the given running tasks to the slave, which may have missed
+// updates while the executor was disconnected: a TASK_RUNNING update carrying the current
+// pod status for every pod that is still around, TASK_LOST for those that went away.
+func (k *KubernetesExecutor) reconcileTasks(tids []string) {
+	for _, tid := range tids {
+		k.lock.RLock()
+		task, found := k.tasks[tid]
+		k.lock.RUnlock()
+		if !found {
+			continue
+		}
+		info, err := k.getPodInfo(task.podName)
+		if err != nil {
+			k.lock.Lock()
+			if _, found := k.tasks[tid]; found {
+				log.Warningf("Pod %v of task %v disappeared while disconnected", task.podName, tid)
+				k.reportLostTask(tid, "Task lost: container disappeared while disconnected")
+			}
+			k.lock.Unlock()
+			continue
+		}
+		k.sendRunningUpdate(task.mesosTaskInfo, task.podName, info, nil)
+	}
+}
+
+// Decodes the BoundPod from TaskInfo.Data. Schedulers that predate the versioned
+// TaskPayload envelope send a bare yaml encoded pod, which is still accepted.
+func decodeBoundPod(data []byte) (*api.BoundPod, error) {
+	payload, err := messages.DecodeTaskPayload(data)
+	if err != nil {
+		pod := &api.BoundPod{}
+		if yerr := yaml.Unmarshal(data, pod); yerr != nil || pod.Name == "" {
+			return nil, err
+		}
+		log.V(1).Infof("Decoded legacy yaml task data for pod %v", pod.Name)
+		return pod, nil
+	}
+	return payload.DecodeBoundPod()
+}
+
+// Advertises the api versions and payload encodings supported by this executor
+// to the scheduler.
+func (k *KubernetesExecutor) sendCapabilities() {
+	msg, err := messages.EncodeFrameworkMessage(messages.CapabilitiesKind, messages.LocalCapabilities())
+	if err != nil {
+		log.Errorf("Failed to encode executor capabilities: %v", err)
+		return
+	}
+	if err := k.driver.SendFrameworkMessage(msg); err != nil {
+		log.Warningf("Failed to send executor capabilities: %v", err)
+	}
+}
+
+// Returns the IP address of the given slave host, or an empty string if it can't be resolved.
+func resolveHostIP(hostname string) string {
+	if ip := net.ParseIP(hostname); ip != nil {
+		return ip.String()
+	}
+	iplist, err := net.LookupIP(hostname)
+	if err != nil || len(iplist) == 0 {
+		log.Warningf("Failed to resolve IP of slave host '%v': %v", hostname, err)
+		return ""
+	}
+	return iplist[0].String()
 }
 
 // Disconnected is called when the executor is disconnected with the slave.
+// Pods keep running and status updates are buffered until the slave comes back,
+// or until the recovery timeout expires.
 func (k *KubernetesExecutor) Disconnected(driver mesos.ExecutorDriver) {
 	log.Infof("Slave is disconnected\n")
+
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
 	k.registered = false
+	if k.recoveryTimeout > 0 && k.recoveryTimer == nil {
+		log.Infof("Waiting up to %v for the slave to recover", k.recoveryTimeout)
+		k.recoveryTimer = time.AfterFunc(k.recoveryTimeout, k.recoveryExpired)
+	}
+}
+
+// Invoked when the slave has failed to reconnect within the recovery timeout:
+// tear down all pods and stop the driver, analogous to the way that Mesos
+// executors commit suicide once slave recovery fails.
+func (k *KubernetesExecutor) recoveryExpired() {
+	k.lock.Lock()
+	if k.registered || k.recoveryTimer == nil {
+		// raced with a reconnect
+		k.lock.Unlock()
+		return
+	}
+	k.recoveryTimer = nil
+
+	log.Errorf("Slave failed to recover within %v, shutting down", k.recoveryTimeout)
+	for tid := range k.tasks {
+		k.killPodForTask(tid, "Executor recovery timeout expired")
+	}
+	for _, taskInfo := range k.pendingLaunches {
+		log.Warningf("Dropping task %v received while disconnected", taskInfo.GetTaskId().GetValue())
+	}
+	k.pendingLaunches = nil
+	k.lock.Unlock()
+
+	// the driver may invoke callbacks, such as Shutdown, that grab the lock
+	k.stopDriver()
 }
 
 // LaunchTask is called when the executor receives a request to launch a task.
 func (k *KubernetesExecutor) LaunchTask(driver mesos.ExecutorDriver, taskInfo *mesos.TaskInfo) {
 	log.Infof("Launch task %v\n", taskInfo)
 
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
 	if !k.registered {
-		log.Warningf("Ignore launch task because the executor is disconnected\n")
-		k.sendStatusUpdate(taskInfo.GetTaskId(),
-			mesos.TaskState_TASK_FAILED, "Executor not registered yet")
+		log.Warningf("Deferring launch of task %v until the slave reconnects\n", taskInfo.GetTaskId().GetValue())
+		k.pendingLaunches = append(k.pendingLaunches, taskInfo)
 		return
 	}
+	k.launchTask(taskInfo)
+}
 
-	k.lock.Lock()
-	defer k.lock.Unlock()
+// Launches the pod of the task. Assumes that the caller is locking around pod and task state.
+func (k *KubernetesExecutor) launchTask(taskInfo *mesos.TaskInfo) {
+	if k.draining {
+		log.Warningf("Ignore launch task because the executor is draining\n")
+		k.sendStatusUpdate(taskInfo.GetTaskId(),
+			mesos.TaskState_TASK_FAILED, "Executor is draining")
+		return
+	}
 
 	taskId := taskInfo.GetTaskId().GetValue()
 	if _, found := k.tasks[taskId]; found {
@@ -92,11 +312,25 @@ func (k *KubernetesExecutor) LaunchTask(driver mesos.ExecutorDriver, taskInfo *m
 		return
 	}
 	// Get the bound pod spec from the taskInfo.
-	var pod api.BoundPod
-	if err := yaml.Unmarshal(taskInfo.GetData(), &pod); err != nil {
-		log.Warningf("Failed to extract yaml data from the taskInfo.data %v\n", err)
+	decoded, err := decodeBoundPod(taskInfo.GetData())
+	if err != nil {
+		log.Warningf("Failed to extract bound pod from the taskInfo.data %v\n", err)
 		k.sendStatusUpdate(taskInfo.GetTaskId(),
-			mesos.TaskState_TASK_FAILED, "Failed to extract yaml data")
+			mesos.TaskState_TASK_FAILED, "Failed to extract bound pod: "+err.Error())
+		return
+	}
+	pod := *decoded
+
+	if err := k.validatePod(&pod, taskInfo); err != nil {
+		log.Warningf("Rejecting task %v: %v", taskId, err)
+		k.sendStatusUpdate(taskInfo.GetTaskId(), mesos.TaskState_TASK_FAILED, err.Error())
+		return
+	}
+
+	// Constrain the pod's containers to the resources that mesos granted to the task.
+	if err := applyResourceLimits(&pod, taskInfo.GetResources()); err != nil {
+		log.Warningf("Rejecting task %v: %v", taskId, err)
+		k.sendStatusUpdate(taskInfo.GetTaskId(), mesos.TaskState_TASK_FAILED, err.Error())
 		return
 	}
 
@@ -108,26 +342,27 @@ func (k *KubernetesExecutor) LaunchTask(driver mesos.ExecutorDriver, taskInfo *m
 		},
 	})
 
+	// Reject the task if another task already owns this pod: the scheduler must kill
+	// the old task first.
+	if tid, found := k.taskForPod(podFullName, pod.UID); found {
+		reason := fmt.Sprintf("Pod '%v' is already running as task %v", podFullName, tid)
+		log.Warningf("Rejecting task %v: %v", taskId, reason)
+		k.sendStatusUpdate(taskInfo.GetTaskId(), mesos.TaskState_TASK_FAILED, reason)
+		return
+	}
+
 	// Add the task.
 	k.tasks[taskId] = &kuberTask{
 		mesosTaskInfo: taskInfo,
 		podName:       podFullName,
 	}
 	k.pods[podFullName] = &pod
-
-	getPidInfo := func(name string) (api.PodInfo, error) {
-		return k.kl.GetPodInfo(name, "")
-	}
+	getPidInfo := k.getPodInfo
 
 	// TODO(nnielsen): Fail if container is already running.
 	// TODO(nnielsen) Checkpoint pods.
 
-	// Send the pod updates to the channel.
-	update := kubelet.PodUpdate{Op: kubelet.SET}
-	for _, p := range k.pods {
-		update.Pods = append(update.Pods, *p)
-	}
-	k.updateChan <- update
+	k.sendPodUpdate()
 
 	// Delay reporting 'task running' until container is up.
 	go func() {
@@ -149,40 +384,31 @@ func (k *KubernetesExecutor) LaunchTask(driver mesos.ExecutorDriver, taskInfo *m
 			}
 
 			// avoid sending back a running status while pod networking is down
-			if podnet, ok := info["net"]; !ok || podnet.State.Running == nil {
+			if podnet, ok := info[networkContainerName]; !ok || podnet.State.Running == nil {
 				continue
 			}
 
 			log.V(2).Infof("Found pod info: '%v'", info)
-			data, err := json.Marshal(info)
-
-			statusUpdate := &mesos.TaskStatus{
-				TaskId:  taskInfo.GetTaskId(),
-				State:   mesos.NewTaskState(mesos.TaskState_TASK_RUNNING),
-				Message: proto.String("Pod '" + podFullName + "' is running"),
-				Data:    data,
-			}
-
-			if err := k.driver.SendStatusUpdate(statusUpdate); err != nil {
-				log.Warningf("Failed to send status update%v, %v", err)
-			}
+			last := k.sendRunningUpdate(taskInfo, podFullName, info, nil)
 
 			// TODO(nnielsen): Monitor health of container and report if lost.
 			// Should we also allow this to fail a couple of times before reporting lost?
 			// What if the docker daemon is restarting and we can't connect, but it's
 			// going to bring the pods back online as soon as it restarts?
-			knownPod := func() bool {
-				_, err := getPidInfo(podFullName)
-				return err == nil
-			}
 			go func() {
-				// Wait for the pod to go away and stop monitoring once it does
+				// Wait for the pod to go away and stop monitoring once it does, reporting
+				// changes to the status of the pod's containers along the way.
 				// TODO (jdefelice) replace with an /events watch?
 				for {
 					time.Sleep(containerPollTime)
+					info, err := getPidInfo(podFullName)
+					knownPod := func() bool {
+						return err == nil
+					}
 					if k.checkForLostPodTask(taskInfo, knownPod) {
 						return
 					}
+					last = k.sendRunningUpdate(taskInfo, podFullName, info, last)
 				}
 			}()
 
@@ -195,6 +421,91 @@ func (k *KubernetesExecutor) LaunchTask(driver mesos.ExecutorDriver, taskInfo *m
 	}()
 }
 
+// Returns the ID of the task that owns the pod with the given full name or UID.
+// Assumes that the caller is locking around pod and task state.
+func (k *KubernetesExecutor) taskForPod(podFullName, uid string) (string, bool) {
+	for tid, task := range k.tasks {
+		if task.podName == podFullName {
+			return tid, true
+		}
+		if pod, found := k.pods[task.podName]; found && uid != "" && pod.UID == uid {
+			return tid, true
+		}
+	}
+	return "", false
+}
+
+// Sends a TASK_RUNNING update carrying the current pod status if it differs from the
+// previously sent status data. Returns the status data most recently sent for the task.
+// Nothing is sent if the task is no longer registered with the executor.
+func (k *KubernetesExecutor) sendRunningUpdate(taskInfo *mesos.TaskInfo, podFullName string, info api.PodInfo, last []byte) []byte {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	task, found := k.tasks[taskInfo.GetTaskId().GetValue()]
+	if !found {
+		return last
+	}
+	task.running = true
+	data, err := json.Marshal(k.podStatus(podFullName, info))
+	if err != nil {
+		log.Errorf("Failed to marshal status of pod %v: %v", podFullName, err)
+		return last
+	}
+	if last != nil && bytes.Equal(data, last) {
+		return last
+	}
+	k.sendStatus(&mesos.TaskStatus{
+		TaskId:  taskInfo.GetTaskId(),
+		State:   mesos.NewTaskState(mesos.TaskState_TASK_RUNNING),
+		Message: proto.String("Pod '" + podFullName + "' is running"),
+		Data:    data,
+	})
+	return data
+}
+
+// Builds the status payload for a TASK_RUNNING update from the pod info reported by the
+// kubelet. Assumes that the caller is locking around pod state.
+func (k *KubernetesExecutor) podStatus(podFullName string, info api.PodInfo) *messages.PodStatus {
+	status := &messages.PodStatus{
+		Version:    messages.StatusVersion,
+		HostIP:     k.hostIP,
+		Containers: make(map[string]messages.ContainerStatus),
+	}
+	if podnet, ok := info[networkContainerName]; ok {
+		status.PodIP = podnet.PodIP
+	}
+	pod := k.pods[podFullName]
+	for name, cs := range info {
+		if name == networkContainerName {
+			continue
+		}
+		container := messages.ContainerStatus{
+			State:        cs.State,
+			RestartCount: cs.RestartCount,
+			Image:        cs.Image,
+		}
+		if pod != nil && cs.State.Running != nil {
+			for _, c := range pod.Spec.Containers {
+				if c.Name != name {
+					continue
+				}
+				for _, port := range c.Ports {
+					if port.HostPort != 0 {
+						container.HostPorts = append(container.HostPorts, messages.PortBinding{
+							ContainerPort: port.ContainerPort,
+							HostPort:      port.HostPort,
+							Protocol:      port.Protocol,
+						})
+					}
+				}
+			}
+		}
+		status.Containers[name] = container
+	}
+	return status
+}
+
 // Intended to be executed as part of the pod monitoring loop, this fn (ultimately) checks with Docker
 // whether the pod is running. It will only return false if the task is still registered and the pod is
 // registered in Docker. Otherwise it returns true. If there's still a task record on file, but no pod
@@ -230,9 +541,16 @@ func (k *KubernetesExecutor) KillTask(driver mesos.ExecutorDriver, taskId *mesos
 	log.Infof("Kill task %v\n", taskId)
 
 	if !k.registered {
-		//TODO(jdefelice) sent TASK_LOST here?
-		log.Warningf("Ignore kill task because the executor is disconnected\n")
-		return
+		// the pod is removed now; the TASK_KILLED update is buffered until the
+		// slave comes back.
+		log.Warningf("Killing task %v while disconnected from the slave\n", taskId.GetValue())
+		for i, taskInfo := range k.pendingLaunches {
+			if taskInfo.GetTaskId().GetValue() == taskId.GetValue() {
+				k.pendingLaunches = append(k.pendingLaunches[:i], k.pendingLaunches[i+1:]...)
+				k.sendStatusUpdate(taskId, mesos.TaskState_TASK_KILLED, "Task killed")
+				return
+			}
+		}
 	}
 
 	k.killPodForTask(taskId.GetValue(), "Task killed")
@@ -241,10 +559,19 @@ func (k *KubernetesExecutor) KillTask(driver mesos.ExecutorDriver, taskId *mesos
 // Kills the pod associated with the given task. Assumes that the caller is locking around
 // pod and task storage.
 func (k *KubernetesExecutor) killPodForTask(tid, reason string) {
+	if task, ok := k.removePodForTask(tid); ok {
+		// TODO(yifan): Check the result of the kill event.
+		k.sendStatusUpdate(task.mesosTaskInfo.GetTaskId(), mesos.TaskState_TASK_KILLED, reason)
+	}
+}
+
+// Forgets the task and removes its pod from the kubelet's configuration, returning
+// the removed task. Assumes that the caller is locking around pod and task storage.
+func (k *KubernetesExecutor) removePodForTask(tid string) (*kuberTask, bool) {
 	task, ok := k.tasks[tid]
 	if !ok {
 		log.Infof("Failed to kill task, unknown task %v\n", tid)
-		return
+		return nil, false
 	}
 	delete(k.tasks, tid)
 
@@ -255,16 +582,118 @@ func (k *KubernetesExecutor) killPodForTask(tid, reason string) {
 		log.V(2).Infof("Deleting pod %v for task %v", pid, tid)
 		delete(k.pods, pid)
 
-		// Send the pod updates to the channel.
-		update := kubelet.PodUpdate{Op: kubelet.SET}
-		for _, p := range k.pods {
-			update.Pods = append(update.Pods, *p)
-		}
-		k.updateChan <- update
+		k.sendPodUpdate()
 	}
-	// TODO(yifan): Check the result of the kill event.
+	return task, true
+}
 
-	k.sendStatusUpdate(task.mesosTaskInfo.GetTaskId(), mesos.TaskState_TASK_KILLED, reason)
+// sendPodUpdate sends the current set of pods to the kubelet and notifies pod
+// watchers of the changes. Assumes that the caller is locking around pod and task state.
+func (k *KubernetesExecutor) sendPodUpdate() {
+	update := kubelet.PodUpdate{Op: kubelet.SET}
+	for _, p := range k.pods {
+		update.Pods = append(update.Pods, *p)
+	}
+	k.updateChan <- update
+	k.podWatch.update(k.pods)
+}
+
+// WatchBoundPods returns a watch of the pods bound to the kubelet, starting with
+// an ADDED event for each pod that is currently bound.
+func (k *KubernetesExecutor) WatchBoundPods() watch.Interface {
+	return k.podWatch.watch()
+}
+
+// Drain puts the executor into drain mode: no new tasks are accepted and the pods
+// of all running tasks are terminated one by one, each reported as TASK_KILLED with
+// messages.DrainReason once its containers are gone so that the scheduler may
+// reschedule it elsewhere. Returns immediately; draining proceeds in the background.
+func (k *KubernetesExecutor) Drain() {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if k.draining {
+		log.V(1).Infof("Executor is already draining")
+		return
+	}
+	k.draining = true
+	k.sendDrainMode()
+	tids := make([]string, 0, len(k.tasks))
+	for tid := range k.tasks {
+		tids = append(tids, tid)
+	}
+	log.Infof("Draining executor of %d task(s)", len(tids))
+	go k.drain(tids)
+}
+
+// Undrain takes the executor out of drain mode: new tasks are accepted again, and
+// the pods of tasks that haven't been terminated yet keep running.
+func (k *KubernetesExecutor) Undrain() {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+
+	if !k.draining {
+		log.V(1).Infof("Executor is not draining")
+		return
+	}
+	log.Infof("Undraining executor")
+	k.draining = false
+	k.sendDrainMode()
+}
+
+// Tells the scheduler whether the executor is draining, so that it stops offering
+// the slave's resources to new pods while it is. Drains may be started over HTTP
+// without the scheduler knowing. Assumes that the caller is locking around executor
+// state.
+func (k *KubernetesExecutor) sendDrainMode() {
+	if !k.registered {
+		// sent upon reconnect
+		return
+	}
+	kind := messages.DrainKind
+	if !k.draining {
+		kind = messages.UndrainKind
+	}
+	msg, err := messages.EncodeFrameworkMessage(kind, nil)
+	if err != nil {
+		log.Errorf("Failed to encode drain mode: %v", err)
+		return
+	}
+	if err := k.driver.SendFrameworkMessage(msg); err != nil {
+		log.Warningf("Failed to send drain mode: %v", err)
+	}
+}
+
+// terminate the pods of the given tasks, one at a time, until undrained.
+func (k *KubernetesExecutor) drain(tids []string) {
+	for _, tid := range tids {
+		k.lock.Lock()
+		if !k.draining {
+			k.lock.Unlock()
+			log.Infof("Executor undrained, stop draining")
+			return
+		}
+		task, ok := k.removePodForTask(tid)
+		k.lock.Unlock()
+		if !ok {
+			// task already went away
+			continue
+		}
+
+		// wait for the kubelet to tear down the pod's containers
+		expires := time.Now().Add(drainGracePeriod)
+		for time.Now().Before(expires) {
+			if _, err := k.getPodInfo(task.podName); err != nil {
+				break
+			}
+			time.Sleep(containerPollTime)
+		}
+
+		k.lock.Lock()
+		k.sendStatusUpdate(task.mesosTaskInfo.GetTaskId(), mesos.TaskState_TASK_KILLED, messages.DrainReason)
+		k.lock.Unlock()
+	}
+	log.Infof("Executor drained")
 }
 
 // Reports a lost task to the slave and updates internal task and pod tracking state.
@@ -284,22 +713,84 @@ func (k *KubernetesExecutor) reportLostTask(tid, reason string) {
 		log.V(2).Infof("Deleting pod %v for lost task %v", pid, tid)
 		delete(k.pods, pid)
 
-		// Send the pod updates to the channel.
-		update := kubelet.PodUpdate{Op: kubelet.SET}
-		for _, p := range k.pods {
-			update.Pods = append(update.Pods, *p)
-		}
-		k.updateChan <- update
+		k.sendPodUpdate()
 	}
 	// TODO(yifan): Check the result of the kill event.
 
 	k.sendStatusUpdate(task.mesosTaskInfo.GetTaskId(), mesos.TaskState_TASK_LOST, reason)
 }
 
+// ReportUsage sends the resource usage of the pods of all running tasks to the
+// scheduler as a framework message. Intended to be invoked periodically.
+func (k *KubernetesExecutor) ReportUsage() {
+	type taskPod struct {
+		taskId string
+		pod    *api.BoundPod
+	}
+	k.lock.RLock()
+	registered := k.registered
+	running := make([]taskPod, 0, len(k.tasks))
+	for tid, task := range k.tasks {
+		if pod, found := k.pods[task.podName]; found {
+			running = append(running, taskPod{tid, pod})
+		}
+	}
+	k.lock.RUnlock()
+
+	if !registered || len(running) == 0 {
+		return
+	}
+
+	// we need at least two samples to calculate cpu usage
+	req := &info.ContainerInfoRequest{NumStats: 2}
+	report := &messages.UsageReport{}
+	for _, tp := range running {
+		stats, err := GetPodStats(k.kl, tp.pod, req)
+		if err != nil {
+			log.V(2).Infof("Failed to collect usage of pod %v/%v: %v", tp.pod.Namespace, tp.pod.Name, err)
+			continue
+		}
+		report.Tasks = append(report.Tasks, messages.TaskUsage{
+			TaskID: tp.taskId,
+			PodUsage: messages.PodUsage{
+				Namespace: tp.pod.Namespace,
+				Name:      tp.pod.Name,
+				UID:       tp.pod.UID,
+				Usage:     stats.Usage,
+			},
+		})
+	}
+	if len(report.Tasks) == 0 {
+		return
+	}
+	msg, err := messages.EncodeFrameworkMessage(messages.UsageReportKind, report)
+	if err != nil {
+		log.Errorf("Failed to encode usage report: %v", err)
+		return
+	}
+	if err := k.driver.SendFrameworkMessage(msg); err != nil {
+		log.Warningf("Failed to send usage report: %v", err)
+	}
+}
+
 // FrameworkMessage is called when the framework sends some message to the executor
 func (k *KubernetesExecutor) FrameworkMessage(driver mesos.ExecutorDriver, message string) {
 	log.Infof("Receives message from framework %v\n", message)
 	// TODO(yifan): Check for update message.
+
+	kind, _, err := messages.DecodeFrameworkMessage(message)
+	if err != nil {
+		log.Warningf("Ignoring unrecognized framework message: %v", err)
+		return
+	}
+	switch kind {
+	case messages.DrainKind:
+		k.Drain()
+	case messages.UndrainKind:
+		k.Undrain()
+	default:
+		log.Warningf("Ignoring framework message of unknown kind %q", kind)
+	}
 }
 
 // Shutdown is called when the executor receives a shutdown request.
@@ -325,8 +816,19 @@ func (k *KubernetesExecutor) sendStatusUpdate(taskId *mesos.TaskID, state mesos.
 		State:   &state,
 		Message: proto.String(message),
 	}
+	k.sendStatus(statusUpdate)
+}
+
+// Sends the status update to the slave, or buffers it if the executor is currently
+// disconnected. Assumes that the caller is locking around executor state.
+func (k *KubernetesExecutor) sendStatus(status *mesos.TaskStatus) {
+	if !k.registered {
+		log.V(2).Infof("Buffering status update for task %v while disconnected", status.GetTaskId().GetValue())
+		k.pendingUpdates = append(k.pendingUpdates, status)
+		return
+	}
 	// TODO(yifan): Maybe try to resend again in the future.
-	if err := k.driver.SendStatusUpdate(statusUpdate); err != nil {
-		log.Warningf("Failed to send status update%v, %v", err)
+	if err := k.driver.SendStatusUpdate(status); err != nil {
+		log.Warningf("Failed to send status update %v: %v", status, err)
 	}
 }
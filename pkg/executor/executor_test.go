@@ -0,0 +1,302 @@
+package executor
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/mesos/mesos-go/mesos"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeDriver records the messages that the executor sends to the slave
+type fakeDriver struct {
+	sync.Mutex
+	updates  []*mesos.TaskStatus
+	messages []string
+}
+
+func (d *fakeDriver) SendStatusUpdate(status *mesos.TaskStatus) error {
+	d.Lock()
+	defer d.Unlock()
+	d.updates = append(d.updates, status)
+	return nil
+}
+
+func (d *fakeDriver) SendFrameworkMessage(msg string) error {
+	d.Lock()
+	defer d.Unlock()
+	d.messages = append(d.messages, msg)
+	return nil
+}
+
+// returns the states of the status updates sent so far, keyed by task id
+func (d *fakeDriver) states() map[string]mesos.TaskState {
+	d.Lock()
+	defer d.Unlock()
+	states := map[string]mesos.TaskState{}
+	for _, status := range d.updates {
+		states[status.GetTaskId().GetValue()] = status.GetState()
+	}
+	return states
+}
+
+// returns the most recent status update sent for the task, if any
+func (d *fakeDriver) lastUpdate(tid string) *mesos.TaskStatus {
+	d.Lock()
+	defer d.Unlock()
+	for i := len(d.updates) - 1; i >= 0; i-- {
+		if d.updates[i].GetTaskId().GetValue() == tid {
+			return d.updates[i]
+		}
+	}
+	return nil
+}
+
+func newTestExecutor(driver *fakeDriver) *KubernetesExecutor {
+	return &KubernetesExecutor{
+		updateChan: make(chan interface{}, 100),
+		driver:     driver,
+		stopDriver: func() {},
+		getPodInfo: func(string) (api.PodInfo, error) {
+			return nil, errors.New("no such pod")
+		},
+		tasks:    make(map[string]*kuberTask),
+		pods:     make(map[string]*api.BoundPod),
+		podWatch: newPodBroadcaster(),
+	}
+}
+
+// adds a running task to the executor, as if it had been launched
+func addRunningTask(k *KubernetesExecutor, tid, podName string) {
+	k.tasks[tid] = &kuberTask{
+		mesosTaskInfo: &mesos.TaskInfo{TaskId: &mesos.TaskID{Value: proto.String(tid)}},
+		podName:       podName,
+		running:       true,
+	}
+	k.pods[podName] = &api.BoundPod{ObjectMeta: api.ObjectMeta{Name: podName, Namespace: "default"}}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestExecutor_BuffersUpdatesWhileDisconnected(t *testing.T) {
+	assert := assert.New(t)
+	driver := &fakeDriver{}
+	k := newTestExecutor(driver)
+	k.getPodInfo = func(string) (api.PodInfo, error) {
+		return api.PodInfo{networkContainerName: api.ContainerStatus{
+			State: api.ContainerState{Running: &api.ContainerStateRunning{}},
+		}}, nil
+	}
+	k.Reregistered(nil, nil)
+	addRunningTask(k, "t1", "foo.default.k8sm")
+	addRunningTask(k, "t2", "bar.default.k8sm")
+
+	k.Disconnected(nil)
+	k.KillTask(nil, &mesos.TaskID{Value: proto.String("t1")})
+	assert.Empty(driver.states(), "no update should reach the slave while disconnected")
+	assert.Nil(k.pods["foo.default.k8sm"])
+	assert.NotNil(k.pods["bar.default.k8sm"], "other pods keep running")
+
+	k.Reregistered(nil, nil)
+	waitFor(t, "reconciliation", func() bool { return len(driver.states()) == 2 })
+	assert.Equal(mesos.TaskState_TASK_KILLED, driver.states()["t1"])
+	assert.Equal(mesos.TaskState_TASK_RUNNING, driver.states()["t2"])
+}
+
+func TestExecutor_ReconcileReportsLostPods(t *testing.T) {
+	assert := assert.New(t)
+	driver := &fakeDriver{}
+	k := newTestExecutor(driver)
+	k.Reregistered(nil, nil)
+	addRunningTask(k, "t1", "foo.default.k8sm")
+
+	// the pod goes away while the slave is gone
+	k.Disconnected(nil)
+	k.Reregistered(nil, nil)
+
+	waitFor(t, "reconciliation", func() bool { return len(driver.states()) == 1 })
+	assert.Equal(mesos.TaskState_TASK_LOST, driver.states()["t1"])
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	assert.Empty(k.tasks)
+	assert.Empty(k.pods)
+}
+
+func TestExecutor_LaunchWhileDisconnected(t *testing.T) {
+	assert := assert.New(t)
+	driver := &fakeDriver{}
+	k := newTestExecutor(driver)
+	k.Reregistered(nil, nil)
+	k.Disconnected(nil)
+
+	taskInfo := func(tid string) *mesos.TaskInfo {
+		return &mesos.TaskInfo{TaskId: &mesos.TaskID{Value: proto.String(tid)}}
+	}
+	k.LaunchTask(nil, taskInfo("t1"))
+	k.LaunchTask(nil, taskInfo("t2"))
+	k.KillTask(nil, &mesos.TaskID{Value: proto.String("t2")})
+	assert.Empty(driver.states())
+	assert.Len(k.pendingLaunches, 1)
+
+	// t1 is launched once the slave is back; it fails because it carries no pod
+	k.Reregistered(nil, nil)
+	assert.Equal(mesos.TaskState_TASK_FAILED, driver.states()["t1"])
+	assert.Equal(mesos.TaskState_TASK_KILLED, driver.states()["t2"])
+	assert.Empty(k.pendingLaunches)
+}
+
+func TestExecutor_RecoveryTimeoutExpires(t *testing.T) {
+	assert := assert.New(t)
+	driver := &fakeDriver{}
+	k := newTestExecutor(driver)
+	k.recoveryTimeout = 10 * time.Millisecond
+	stopped := make(chan struct{})
+	k.stopDriver = func() {
+		// the driver may call back into the executor while stopping
+		k.Shutdown(nil)
+		close(stopped)
+	}
+	k.Reregistered(nil, nil)
+	addRunningTask(k, "t1", "foo.default.k8sm")
+
+	k.Disconnected(nil)
+	k.LaunchTask(nil, &mesos.TaskInfo{TaskId: &mesos.TaskID{Value: proto.String("t2")}})
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("driver was not stopped after the recovery timeout expired")
+	}
+
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	assert.Empty(k.tasks)
+	assert.Empty(k.pods)
+	assert.Empty(k.pendingLaunches)
+	assert.Len(k.pendingUpdates, 1, "TASK_KILLED is buffered since the slave never came back")
+}
+
+func TestExecutor_ReconnectCancelsRecoveryTimeout(t *testing.T) {
+	driver := &fakeDriver{}
+	k := newTestExecutor(driver)
+	k.recoveryTimeout = 50 * time.Millisecond
+	stopped := make(chan struct{})
+	k.stopDriver = func() { close(stopped) }
+	k.Reregistered(nil, nil)
+
+	k.Disconnected(nil)
+	k.Reregistered(nil, nil)
+	select {
+	case <-stopped:
+		t.Fatal("driver was stopped although the slave came back")
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestExecutor_DrainAndUndrain(t *testing.T) {
+	assert := assert.New(t)
+	driver := &fakeDriver{}
+	k := newTestExecutor(driver)
+	k.Reregistered(nil, nil)
+
+	drain, _ := messages.EncodeFrameworkMessage(messages.DrainKind, nil)
+	k.FrameworkMessage(nil, drain)
+	k.LaunchTask(nil, &mesos.TaskInfo{TaskId: &mesos.TaskID{Value: proto.String("t1")}})
+	assert.Equal("Executor is draining", driver.updates[0].GetMessage())
+
+	undrain, _ := messages.EncodeFrameworkMessage(messages.UndrainKind, nil)
+	k.FrameworkMessage(nil, undrain)
+	k.LaunchTask(nil, &mesos.TaskInfo{TaskId: &mesos.TaskID{Value: proto.String("t2")}})
+	assert.NotEqual("Executor is draining", driver.updates[1].GetMessage())
+
+	// the scheduler is told about every change of the drain mode
+	assert.Equal([]string{drain, undrain}, driver.messages[1:])
+}
+
+func TestExecutor_DrainWhileDisconnected(t *testing.T) {
+	assert := assert.New(t)
+	driver := &fakeDriver{}
+	k := newTestExecutor(driver)
+	k.Reregistered(nil, nil)
+	k.Disconnected(nil)
+
+	// as if drained over HTTP
+	k.Drain()
+	assert.Len(driver.messages, 1, "the drain mode isn't sent while disconnected")
+
+	k.Reregistered(nil, nil)
+	drain, _ := messages.EncodeFrameworkMessage(messages.DrainKind, nil)
+	assert.Equal(drain, driver.messages[len(driver.messages)-1])
+}
+
+// returns a task that carries the given pod
+func podTask(t *testing.T, tid string, pod *api.BoundPod) *mesos.TaskInfo {
+	data, err := messages.EncodeBoundPod(pod, messages.DefaultApiVersion, messages.EncodingJSON)
+	if err != nil {
+		t.Fatalf("failed to encode pod: %v", err)
+	}
+	return &mesos.TaskInfo{TaskId: &mesos.TaskID{Value: proto.String(tid)}, Data: data}
+}
+
+func namedPod(name, uid string) *api.BoundPod {
+	return &api.BoundPod{
+		ObjectMeta: api.ObjectMeta{Name: name, Namespace: "default", UID: uid},
+		Spec:       api.PodSpec{Containers: []api.Container{{Name: "web", Image: "nginx"}}},
+	}
+}
+
+func TestExecutor_RejectsDuplicatePodName(t *testing.T) {
+	assert := assert.New(t)
+	driver := &fakeDriver{}
+	k := newTestExecutor(driver)
+	k.sourcename = "k8sm"
+	k.Reregistered(nil, nil)
+
+	k.LaunchTask(nil, podTask(t, "t1", namedPod("foo", "uid-1")))
+	assert.Nil(driver.lastUpdate("t1"))
+	assert.NotNil(k.tasks["t1"])
+
+	k.LaunchTask(nil, podTask(t, "t2", namedPod("foo", "uid-2")))
+	if status := driver.lastUpdate("t2"); assert.NotNil(status) {
+		assert.Equal(mesos.TaskState_TASK_FAILED, status.GetState())
+		assert.Equal("Pod 'foo.default.k8sm' is already running as task t1", status.GetMessage())
+	}
+	assert.Nil(k.tasks["t2"])
+	assert.Len(k.pods, 1)
+}
+
+func TestExecutor_RejectsDuplicatePodUID(t *testing.T) {
+	assert := assert.New(t)
+	driver := &fakeDriver{}
+	k := newTestExecutor(driver)
+	k.sourcename = "k8sm"
+	k.Reregistered(nil, nil)
+
+	k.LaunchTask(nil, podTask(t, "t1", namedPod("foo", "uid-1")))
+	assert.Nil(driver.lastUpdate("t1"))
+
+	// the same pod under another name is still the same pod
+	k.LaunchTask(nil, podTask(t, "t2", namedPod("bar", "uid-1")))
+	if status := driver.lastUpdate("t2"); assert.NotNil(status) {
+		assert.Equal(mesos.TaskState_TASK_FAILED, status.GetState())
+		assert.Equal("Pod 'bar.default.k8sm' is already running as task t1", status.GetMessage())
+	}
+	assert.Nil(k.tasks["t2"])
+	assert.Nil(k.pods["bar.default.k8sm"])
+
+	// pods without a UID are only matched by name
+	k.LaunchTask(nil, podTask(t, "t3", namedPod("baz", "")))
+	assert.Nil(driver.lastUpdate("t3"))
+	assert.NotNil(k.tasks["t3"])
+}
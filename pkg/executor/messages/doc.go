@@ -0,0 +1,5 @@
+/*
+Package messages defines the data exchanged between the kubelet-executor
+and the scheduler by way of mesos TaskStatus and framework messages.
+*/
+package messages
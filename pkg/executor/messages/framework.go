@@ -0,0 +1,55 @@
+package messages
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Kinds of framework messages exchanged between the executor and the scheduler.
+const (
+	UsageReportKind  = "usageReport"  // executor -> scheduler, payload is a UsageReport
+	DrainKind        = "drain"        // scheduler <-> executor, no payload
+	UndrainKind      = "undrain"      // scheduler <-> executor, no payload
+	CapabilitiesKind = "capabilities" // executor -> scheduler, payload is ExecutorCapabilities
+)
+
+// DrainReason is the TaskStatus message of TASK_KILLED updates for tasks that were
+// terminated because their executor was drained.
+const DrainReason = "Executor draining"
+
+// frameworkMessage is the JSON envelope of every framework message.
+type frameworkMessage struct {
+	Kind    string          `json:"kind"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// EncodeFrameworkMessage wraps the JSON encoding of payload in an envelope of the
+// given kind, suitable for use with SendFrameworkMessage.
+func EncodeFrameworkMessage(kind string, payload interface{}) (string, error) {
+	var raw json.RawMessage
+	if payload != nil {
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return "", err
+		}
+		raw = json.RawMessage(data)
+	}
+	data, err := json.Marshal(&frameworkMessage{Kind: kind, Payload: raw})
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// DecodeFrameworkMessage returns the kind and the raw payload of a framework
+// message produced by EncodeFrameworkMessage.
+func DecodeFrameworkMessage(message string) (string, json.RawMessage, error) {
+	msg := &frameworkMessage{}
+	if err := json.Unmarshal([]byte(message), msg); err != nil {
+		return "", nil, err
+	}
+	if msg.Kind == "" {
+		return "", nil, fmt.Errorf("framework message is missing a kind: %q", message)
+	}
+	return msg.Kind, msg.Payload, nil
+}
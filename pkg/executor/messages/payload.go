@@ -0,0 +1,144 @@
+package messages
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/latest"
+	"gopkg.in/v2/yaml"
+)
+
+// Wire formats of the TaskPayload envelope.
+const (
+	EncodingJSON     = "json"
+	EncodingProtobuf = "protobuf"
+
+	// EncodingLegacyYAML isn't an envelope: the pod is sent as bare yaml, the only
+	// format understood by executors that predate TaskPayload. It's used until an
+	// executor has advertised its capabilities.
+	EncodingLegacyYAML = "legacy-yaml"
+)
+
+// DefaultApiVersion is the oldest api version that executors which advertise their
+// capabilities support.
+const DefaultApiVersion = "v1beta1"
+
+var errEmptyPayload = errors.New("empty task payload")
+
+// ExecutorCapabilities is advertised by the executor to the scheduler upon
+// (re)registration, by way of a framework message of kind CapabilitiesKind.
+type ExecutorCapabilities struct {
+	ApiVersions []string `json:"apiVersions"` // api versions the executor can decode pods from
+	Encodings   []string `json:"encodings"`   // TaskPayload wire formats the executor understands
+}
+
+// LocalCapabilities returns the capabilities of this binary.
+func LocalCapabilities() *ExecutorCapabilities {
+	return &ExecutorCapabilities{
+		ApiVersions: append([]string{}, latest.Versions...),
+		Encodings:   []string{EncodingJSON, EncodingProtobuf},
+	}
+}
+
+// TaskPayload is the versioned envelope of the BoundPod carried in TaskInfo.Data.
+// The envelope itself is serialized as either protobuf or JSON; Data holds the
+// pod as encoded by the k8s codec of ApiVersion.
+type TaskPayload struct {
+	ApiVersion       *string `protobuf:"bytes,1,opt,name=apiVersion" json:"apiVersion,omitempty"`
+	Encoding         *string `protobuf:"bytes,2,opt,name=encoding" json:"encoding,omitempty"` // encoding of Data
+	Data             []byte  `protobuf:"bytes,3,opt,name=data" json:"data,omitempty"`
+	XXX_unrecognized []byte  `json:"-"`
+}
+
+func (m *TaskPayload) Reset()         { *m = TaskPayload{} }
+func (m *TaskPayload) String() string { return proto.CompactTextString(m) }
+func (*TaskPayload) ProtoMessage()    {}
+
+func (m *TaskPayload) GetApiVersion() string {
+	if m != nil && m.ApiVersion != nil {
+		return *m.ApiVersion
+	}
+	return ""
+}
+
+func (m *TaskPayload) GetEncoding() string {
+	if m != nil && m.Encoding != nil {
+		return *m.Encoding
+	}
+	return ""
+}
+
+// EncodeBoundPod wraps the pod, encoded with the codec of the given api version,
+// in a TaskPayload serialized in the given wire format. The api version is ignored
+// by EncodingLegacyYAML.
+func EncodeBoundPod(pod *api.BoundPod, apiVersion, encoding string) ([]byte, error) {
+	if encoding == EncodingLegacyYAML {
+		return yaml.Marshal(pod)
+	}
+	interfaces, err := latest.InterfacesFor(apiVersion)
+	if err != nil {
+		return nil, err
+	}
+	data, err := interfaces.Codec.Encode(pod)
+	if err != nil {
+		return nil, err
+	}
+	payload := &TaskPayload{
+		ApiVersion: proto.String(apiVersion),
+		Encoding:   proto.String(EncodingJSON),
+		Data:       data,
+	}
+	switch encoding {
+	case EncodingJSON:
+		return json.Marshal(payload)
+	case EncodingProtobuf:
+		return proto.Marshal(payload)
+	default:
+		return nil, fmt.Errorf("unsupported task payload encoding %q", encoding)
+	}
+}
+
+// DecodeTaskPayload unmarshals the TaskPayload envelope, detecting its wire format.
+func DecodeTaskPayload(data []byte) (*TaskPayload, error) {
+	if len(data) == 0 {
+		return nil, errEmptyPayload
+	}
+	payload := &TaskPayload{}
+	var err error
+	if data[0] == '{' {
+		err = json.Unmarshal(data, payload)
+	} else {
+		err = proto.Unmarshal(data, payload)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if payload.GetApiVersion() == "" {
+		return nil, errors.New("task payload is missing an api version")
+	}
+	return payload, nil
+}
+
+// DecodeBoundPod decodes the pod carried by the TaskPayload, failing with a
+// descriptive error if its api version or encoding isn't supported.
+func (p *TaskPayload) DecodeBoundPod() (*api.BoundPod, error) {
+	if enc := p.GetEncoding(); enc != "" && enc != EncodingJSON {
+		return nil, fmt.Errorf("unsupported pod encoding %q", enc)
+	}
+	interfaces, err := latest.InterfacesFor(p.GetApiVersion())
+	if err != nil {
+		return nil, fmt.Errorf("unsupported api version %q, supported versions are %v", p.GetApiVersion(), latest.Versions)
+	}
+	obj, err := interfaces.Codec.Decode(p.Data)
+	if err != nil {
+		return nil, err
+	}
+	pod, ok := obj.(*api.BoundPod)
+	if !ok {
+		return nil, fmt.Errorf("task payload contains a %T, expected a BoundPod", obj)
+	}
+	return pod, nil
+}
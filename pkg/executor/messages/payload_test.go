@@ -0,0 +1,66 @@
+package messages
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/v2/yaml"
+)
+
+func testPod() *api.BoundPod {
+	return &api.BoundPod{
+		ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec:       api.PodSpec{Containers: []api.Container{{Name: "web", Image: "nginx"}}},
+	}
+}
+
+func TestEncodeBoundPod_RoundTrip(t *testing.T) {
+	for _, encoding := range []string{EncodingJSON, EncodingProtobuf} {
+		data, err := EncodeBoundPod(testPod(), DefaultApiVersion, encoding)
+		if !assert.NoError(t, err, encoding) {
+			continue
+		}
+		payload, err := DecodeTaskPayload(data)
+		if !assert.NoError(t, err, encoding) {
+			continue
+		}
+		assert.Equal(t, DefaultApiVersion, payload.GetApiVersion(), encoding)
+		assert.Equal(t, EncodingJSON, payload.GetEncoding(), encoding)
+
+		pod, err := payload.DecodeBoundPod()
+		if assert.NoError(t, err, encoding) {
+			assert.Equal(t, "foo", pod.Name, encoding)
+			assert.Equal(t, "nginx", pod.Spec.Containers[0].Image, encoding)
+		}
+	}
+}
+
+func TestEncodeBoundPod_LegacyYAML(t *testing.T) {
+	data, err := EncodeBoundPod(testPod(), "", EncodingLegacyYAML)
+	assert.NoError(t, err)
+
+	// what executors that predate the envelope do with the task data
+	pod := &api.BoundPod{}
+	assert.NoError(t, yaml.Unmarshal(data, pod))
+	assert.Equal(t, "foo", pod.Name)
+	assert.Equal(t, "nginx", pod.Spec.Containers[0].Image)
+
+	_, err = DecodeTaskPayload(data)
+	assert.Error(t, err)
+}
+
+func TestDecodeTaskPayload_Unsupported(t *testing.T) {
+	_, err := DecodeTaskPayload(nil)
+	assert.Equal(t, errEmptyPayload, err)
+
+	payload, err := DecodeTaskPayload([]byte(`{"apiVersion":"v99","data":"e30="}`))
+	assert.NoError(t, err)
+	_, err = payload.DecodeBoundPod()
+	assert.Error(t, err)
+
+	payload, err = DecodeTaskPayload([]byte(`{"apiVersion":"v1beta1","encoding":"xml"}`))
+	assert.NoError(t, err)
+	_, err = payload.DecodeBoundPod()
+	assert.Error(t, err)
+}
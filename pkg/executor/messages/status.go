@@ -0,0 +1,108 @@
+package messages
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+)
+
+// StatusVersion is the current version of the PodStatus schema. Bump this
+// whenever a field changes in an incompatible way.
+const StatusVersion = 1
+
+// name of the pod's network container in the legacy api.PodInfo status data
+const legacyNetworkContainerName = "net"
+
+// PodStatus is the payload carried in TaskStatus.Data of every TASK_RUNNING
+// update sent by the executor. It is JSON encoded.
+//
+// Executors that predate this schema send the api.PodInfo of the pod instead,
+// which DecodePodStatus converts into a PodStatus of version 0.
+type PodStatus struct {
+	// Version of this schema, always StatusVersion when produced by the executor.
+	Version int `json:"version"`
+	// IP address of the pod's network container, empty if not yet known.
+	PodIP string `json:"podIP,omitempty"`
+	// IP address of the slave that hosts the pod, empty if not yet known.
+	HostIP string `json:"hostIP,omitempty"`
+	// Status of each of the pod's containers, keyed by container name. The pod's
+	// network container is not included.
+	Containers map[string]ContainerStatus `json:"containers,omitempty"`
+}
+
+// ContainerStatus describes the state of a single pod container.
+type ContainerStatus struct {
+	State        api.ContainerState `json:"state"`
+	RestartCount int                `json:"restartCount"`
+	Image        string             `json:"image,omitempty"`
+	// Host ports that the spec of the running container asks for. These are
+	// not read back from docker.
+	HostPorts []PortBinding `json:"hostPorts,omitempty"`
+}
+
+// PortBinding maps a container port to the host port requested for it.
+type PortBinding struct {
+	ContainerPort int          `json:"containerPort"`
+	HostPort      int          `json:"hostPort"`
+	Protocol      api.Protocol `json:"protocol,omitempty"`
+}
+
+// DecodePodStatus unmarshals a PodStatus from TaskStatus.Data, failing if the
+// data was produced by an unsupported version of the schema. Data without a
+// version is decoded as the legacy api.PodInfo.
+func DecodePodStatus(data []byte) (*PodStatus, error) {
+	probe := struct {
+		Version *int `json:"version"`
+	}{}
+	if err := json.Unmarshal(data, &probe); err != nil {
+		return nil, err
+	}
+	if probe.Version == nil {
+		return decodeLegacyPodStatus(data)
+	}
+	status := &PodStatus{}
+	if err := json.Unmarshal(data, status); err != nil {
+		return nil, err
+	}
+	if status.Version != StatusVersion {
+		return nil, fmt.Errorf("unsupported pod status version %d, expected %d", status.Version, StatusVersion)
+	}
+	return status, nil
+}
+
+// Info converts the container status into an api.PodInfo, suitable for
+// storing in api.PodStatus.Info.
+func (s *PodStatus) Info() api.PodInfo {
+	info := api.PodInfo{}
+	for name, c := range s.Containers {
+		info[name] = api.ContainerStatus{
+			State:        c.State,
+			RestartCount: c.RestartCount,
+			PodIP:        s.PodIP,
+			Image:        c.Image,
+		}
+	}
+	return info
+}
+
+// converts the api.PodInfo sent by executors that predate PodStatus
+func decodeLegacyPodStatus(data []byte) (*PodStatus, error) {
+	info := api.PodInfo{}
+	if err := json.Unmarshal(data, &info); err != nil {
+		return nil, err
+	}
+	status := &PodStatus{Containers: make(map[string]ContainerStatus)}
+	for name, cs := range info {
+		if name == legacyNetworkContainerName {
+			status.PodIP = cs.PodIP
+			continue
+		}
+		status.Containers[name] = ContainerStatus{
+			State:        cs.State,
+			RestartCount: cs.RestartCount,
+			Image:        cs.Image,
+		}
+	}
+	return status, nil
+}
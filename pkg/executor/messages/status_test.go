@@ -0,0 +1,44 @@
+package messages
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDecodePodStatus(t *testing.T) {
+	assert := assert.New(t)
+	data, _ := json.Marshal(&PodStatus{
+		Version: StatusVersion,
+		PodIP:   "10.2.0.5",
+		HostIP:  "10.0.0.1",
+		Containers: map[string]ContainerStatus{
+			"web": {RestartCount: 2, Image: "nginx"},
+		},
+	})
+	status, err := DecodePodStatus(data)
+	assert.NoError(err)
+	assert.Equal("10.2.0.5", status.PodIP)
+	assert.Equal("10.0.0.1", status.HostIP)
+	assert.Equal(2, status.Info()["web"].RestartCount)
+
+	_, err = DecodePodStatus([]byte(`{"version":99}`))
+	assert.Error(err)
+}
+
+func TestDecodePodStatus_Legacy(t *testing.T) {
+	assert := assert.New(t)
+	data, _ := json.Marshal(api.PodInfo{
+		"net": api.ContainerStatus{PodIP: "10.2.0.5"},
+		"web": api.ContainerStatus{RestartCount: 1, Image: "nginx"},
+	})
+	status, err := DecodePodStatus(data)
+	assert.NoError(err)
+	assert.Equal(0, status.Version)
+	assert.Equal("10.2.0.5", status.PodIP)
+	_, found := status.Containers["net"]
+	assert.False(found)
+	assert.Equal(ContainerStatus{RestartCount: 1, Image: "nginx"}, status.Containers["web"])
+}
@@ -0,0 +1,42 @@
+package messages
+
+import (
+	"time"
+)
+
+// ResourceUsage is a point-in-time summary of the resources consumed by the
+// containers of a pod, as observed by cAdvisor.
+type ResourceUsage struct {
+	Timestamp time.Time `json:"timestamp"`
+	// Cumulative CPU time consumed, in nanoseconds.
+	CpuTotal uint64 `json:"cpuTotal"`
+	// Average number of cores in use between the two most recent samples; zero
+	// if only one sample was available.
+	Cpus float64 `json:"cpus"`
+	// Memory usage and working set, in bytes.
+	MemoryUsage      uint64 `json:"memoryUsage"`
+	MemoryWorkingSet uint64 `json:"memoryWorkingSet"`
+	// Cumulative network traffic of the pod's network namespace, in bytes.
+	NetworkRxBytes uint64 `json:"networkRxBytes"`
+	NetworkTxBytes uint64 `json:"networkTxBytes"`
+}
+
+// PodUsage associates resource usage with a pod.
+type PodUsage struct {
+	Namespace string        `json:"namespace"`
+	Name      string        `json:"name"`
+	UID       string        `json:"uid,omitempty"`
+	Usage     ResourceUsage `json:"usage"`
+}
+
+// TaskUsage is the resource usage of the pod launched by a mesos task.
+type TaskUsage struct {
+	TaskID string `json:"taskID"`
+	PodUsage
+}
+
+// UsageReport is periodically sent by the executor to the scheduler, and covers
+// every running task of the executor.
+type UsageReport struct {
+	Tasks []TaskUsage `json:"tasks"`
+}
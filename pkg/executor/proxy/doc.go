@@ -0,0 +1,5 @@
+/*
+Package proxy manages the kubernetes service proxy on behalf of the
+kubelet-executor.
+*/
+package proxy
@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	kproxy "github.com/GoogleCloudPlatform/kubernetes/pkg/proxy"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/proxy/config"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util/exec"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/util/iptables"
+	"github.com/coreos/go-etcd/etcd"
+	log "github.com/golang/glog"
+)
+
+// InProcessConfig describes how to configure a service proxy that runs within
+// the executor process.
+type InProcessConfig struct {
+	BindAddress    net.IP   // the address that the proxy serves on
+	EtcdServers    []string // etcd servers to watch for services and endpoints
+	EtcdConfigFile string   // etcd client config file, used if EtcdServers is empty
+}
+
+// InProcess runs the upstream service proxy within the executor process, so that
+// a separate kube-proxy executable isn't required. The proxy's lifecycle is bound
+// to that of the executor.
+type InProcess struct {
+	config InProcessConfig
+	lock   sync.RWMutex
+	status Status
+}
+
+// NewInProcess creates an in-process proxy; the proxy isn't started until Run is invoked.
+func NewInProcess(config InProcessConfig) *InProcess {
+	return &InProcess{
+		config: config,
+		status: Status{
+			Mode:  "inprocess",
+			State: StateStopped,
+			Since: time.Now(),
+		},
+	}
+}
+
+// Status returns the current state of the proxy.
+func (p *InProcess) Status() Status {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.status
+}
+
+func (p *InProcess) setState(state State, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.status.State = state
+	p.status.Since = time.Now()
+	if err != nil {
+		p.status.LastError = err.Error()
+	}
+}
+
+// Run starts the proxy and blocks until done is closed. The upstream proxier
+// cannot be stopped, so its sync loop keeps running until the process exits.
+// HACK(jdef): adapted from k8s /cmd/proxy/proxy.go
+func (p *InProcess) Run(done <-chan struct{}) {
+	p.setState(StateStarting, nil)
+
+	var etcdClient *etcd.Client
+	if len(p.config.EtcdServers) > 0 {
+		etcdClient = etcd.NewClient(p.config.EtcdServers)
+	} else if p.config.EtcdConfigFile != "" {
+		var err error
+		if etcdClient, err = etcd.NewClientFromFile(p.config.EtcdConfigFile); err != nil {
+			log.Errorf("Failed to create etcd client for the proxy: %v", err)
+			p.setState(StateStopped, err)
+			return
+		}
+	} else {
+		err := errors.New("no etcd configuration for the proxy")
+		log.Error(err)
+		p.setState(StateStopped, err)
+		return
+	}
+
+	serviceConfig := config.NewServiceConfig()
+	endpointsConfig := config.NewEndpointsConfig()
+
+	protocol := iptables.ProtocolIpv4
+	if p.config.BindAddress.To4() == nil {
+		protocol = iptables.ProtocolIpv6
+	}
+	loadBalancer := kproxy.NewLoadBalancerRR()
+	proxier := kproxy.NewProxier(loadBalancer, p.config.BindAddress, iptables.New(exec.New(), protocol))
+	if proxier == nil {
+		err := errors.New("failed to create proxier")
+		log.Error(err)
+		p.setState(StateStopped, err)
+		return
+	}
+
+	// handlers must be registered before sources are created, otherwise the
+	// initial updates may be lost
+	serviceConfig.RegisterHandler(proxier)
+	endpointsConfig.RegisterHandler(loadBalancer)
+
+	log.Infof("Starting in-process proxy using etcd servers %v", etcdClient.GetCluster())
+	config.NewConfigSourceEtcd(etcdClient,
+		serviceConfig.Channel("etcd"),
+		endpointsConfig.Channel("etcd"))
+
+	go proxier.SyncLoop()
+	p.setState(StateRunning, nil)
+
+	<-done
+}
@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+)
+
+var errWriterClosed = errors.New("log writer is closed")
+
+// rotatingWriter is an io.WriteCloser that appends to a file, rotating it once it
+// grows beyond a maximum size. Rotated files are suffixed with .1 (most recent)
+// through .<backups> (oldest).
+type rotatingWriter struct {
+	path     string
+	maxBytes int64
+	backups  int
+	lock     sync.Mutex
+	file     *os.File
+	size     int64
+}
+
+func newRotatingWriter(path string, maxBytes int64, backups int) (*rotatingWriter, error) {
+	w := &rotatingWriter{
+		path:     path,
+		maxBytes: maxBytes,
+		backups:  backups,
+	}
+	if err := w.open(); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func (w *rotatingWriter) open() error {
+	f, err := os.OpenFile(w.path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	w.file = f
+	w.size = info.Size()
+	return nil
+}
+
+// assumes that the caller is holding the lock
+func (w *rotatingWriter) rotate() error {
+	if err := w.file.Close(); err != nil {
+		return err
+	}
+	w.file = nil
+	if w.backups > 0 {
+		for i := w.backups - 1; i > 0; i-- {
+			// ignore errors here, the older files may not exist yet
+			os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+		}
+		if err := os.Rename(w.path, w.path+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(w.path); err != nil {
+		return err
+	}
+	return w.open()
+}
+
+func (w *rotatingWriter) Write(p []byte) (int, error) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return 0, errWriterClosed
+	}
+	if w.maxBytes > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxBytes {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+func (w *rotatingWriter) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	return err
+}
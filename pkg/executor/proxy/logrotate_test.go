@@ -0,0 +1,121 @@
+package proxy
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "k8sm-proxy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return dir
+}
+
+// returns the contents of the file, or "<missing>" if it doesn't exist
+func contents(path string) string {
+	data, err := ioutil.ReadFile(path)
+	if os.IsNotExist(err) {
+		return "<missing>"
+	}
+	return string(data)
+}
+
+func TestRotatingWriter_Rotates(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "proxy.log")
+
+	w, err := newRotatingWriter(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for _, s := range []string{"0123456789", "abc", "defghijk", "lmn"} {
+		_, err := w.Write([]byte(s))
+		assert.NoError(err)
+	}
+	// each write that would grow the log beyond 10 bytes rotates it first, and
+	// only the two most recent backups are kept
+	assert.Equal("lmn", contents(path))
+	assert.Equal("defghijk", contents(path+".1"))
+	assert.Equal("abc", contents(path+".2"))
+	assert.Equal("<missing>", contents(path+".3"))
+}
+
+func TestRotatingWriter_BackupShifting(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "proxy.log")
+
+	w, err := newRotatingWriter(path, 4, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for _, s := range []string{"aaaa", "bbbb", "cccc", "dddd", "eeee"} {
+		_, err := w.Write([]byte(s))
+		assert.NoError(err)
+	}
+	assert.Equal("eeee", contents(path))
+	assert.Equal("dddd", contents(path+".1"))
+	assert.Equal("cccc", contents(path+".2"))
+	assert.Equal("bbbb", contents(path+".3"))
+	assert.Equal("<missing>", contents(path+".4"))
+}
+
+func TestRotatingWriter_NoBackups(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "proxy.log")
+
+	w, err := newRotatingWriter(path, 4, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+
+	for _, s := range []string{"aaaa", "bbbb"} {
+		_, err := w.Write([]byte(s))
+		assert.NoError(err)
+	}
+	assert.Equal("bbbb", contents(path))
+	assert.Equal("<missing>", contents(path+".1"))
+}
+
+func TestRotatingWriter_AppendsAndClose(t *testing.T) {
+	assert := assert.New(t)
+	dir := tempDir(t)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "proxy.log")
+	assert.NoError(ioutil.WriteFile(path, []byte("old"), 0644))
+
+	// the size of an existing log counts towards rotation
+	w, err := newRotatingWriter(path, 5, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.Write([]byte("new"))
+	assert.NoError(err)
+	assert.Equal("new", contents(path))
+	assert.Equal("old", contents(path+".1"))
+
+	// a single write larger than the limit goes to a fresh log as a whole
+	_, err = w.Write([]byte("0123456789"))
+	assert.NoError(err)
+	assert.Equal("0123456789", contents(path))
+
+	assert.NoError(w.Close())
+	_, err = w.Write([]byte("x"))
+	assert.Equal(errWriterClosed, err)
+}
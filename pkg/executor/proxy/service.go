@@ -0,0 +1,9 @@
+package proxy
+
+// Service is a service proxy managed by the executor.
+type Service interface {
+	// Run keeps the proxy running until done is closed. Blocks until done is closed.
+	Run(done <-chan struct{})
+	// Status returns the current state of the proxy.
+	Status() Status
+}
@@ -0,0 +1,189 @@
+package proxy
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"time"
+
+	log "github.com/golang/glog"
+)
+
+const (
+	DefaultExecName = "kube-proxy" // name of the proxy executable fetched into the sandbox
+
+	initialBackoff = 1 * time.Second
+	maxBackoff     = 60 * time.Second
+	stableRunTime  = 60 * time.Second // reset backoff once the proxy has been up this long
+)
+
+// State of the service proxy.
+type State string
+
+const (
+	StateStarting State = "starting"
+	StateRunning  State = "running"
+	StateBackoff  State = "backoff"
+	StateStopped  State = "stopped"
+)
+
+// Status is a snapshot of the state of the service proxy.
+type Status struct {
+	Mode      string    `json:"mode"`
+	Exec      string    `json:"exec,omitempty"`
+	State     State     `json:"state"`
+	Pid       int       `json:"pid,omitempty"`
+	Restarts  int       `json:"restarts"`
+	LastError string    `json:"lastError,omitempty"`
+	Since     time.Time `json:"since"`
+}
+
+// Config describes how to run the proxy process.
+type Config struct {
+	Exec        string   // path to the proxy executable, see FindExec
+	Args        []string // arguments passed to the proxy executable
+	LogFile     string   // the proxy's stdout and stderr are written here
+	LogMaxBytes int64    // rotate the log once it grows beyond this size; <= 0 never rotates
+	LogBackups  int      // number of rotated logs to keep
+}
+
+// Supervisor runs the service proxy as a child process, restarting it with
+// exponential backoff whenever it exits.
+type Supervisor struct {
+	config Config
+	lock   sync.RWMutex
+	status Status
+
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	stableRunTime  time.Duration
+	after          func(time.Duration) <-chan time.Time // waits out the backoff
+}
+
+// NewSupervisor creates a supervisor for a proxy process; the process isn't
+// started until Run is invoked.
+func NewSupervisor(config Config) *Supervisor {
+	return &Supervisor{
+		config: config,
+		status: Status{
+			Mode:  "process",
+			Exec:  config.Exec,
+			State: StateStopped,
+			Since: time.Now(),
+		},
+		initialBackoff: initialBackoff,
+		maxBackoff:     maxBackoff,
+		stableRunTime:  stableRunTime,
+		after:          time.After,
+	}
+}
+
+// FindExec returns the path of the proxy executable. An explicitly configured
+// path is preferred; otherwise the executable is looked for in the mesos sandbox
+// (into which the slave fetches the executor's URIs) and then in the PATH.
+func FindExec(configured string) (string, error) {
+	if configured != "" {
+		return exec.LookPath(configured)
+	}
+	sandbox := os.Getenv("MESOS_DIRECTORY")
+	if sandbox == "" {
+		sandbox = "."
+	}
+	if path, err := exec.LookPath(filepath.Join(sandbox, DefaultExecName)); err == nil {
+		return path, nil
+	}
+	return exec.LookPath(DefaultExecName)
+}
+
+// Status returns the current state of the proxy.
+func (s *Supervisor) Status() Status {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.status
+}
+
+func (s *Supervisor) setState(state State, pid int, err error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.status.State = state
+	s.status.Pid = pid
+	s.status.Since = time.Now()
+	if err != nil {
+		s.status.LastError = err.Error()
+	}
+}
+
+// Run keeps the proxy process running until done is closed, at which point the
+// process is killed. Blocks until done is closed.
+func (s *Supervisor) Run(done <-chan struct{}) {
+	backoff := s.initialBackoff
+	for first := true; ; first = false {
+		if !first {
+			s.lock.Lock()
+			s.status.Restarts++
+			s.lock.Unlock()
+		}
+		started := time.Now()
+		err := s.runOnce(done)
+
+		select {
+		case <-done:
+			s.setState(StateStopped, 0, err)
+			return
+		default:
+		}
+
+		if time.Since(started) >= s.stableRunTime {
+			backoff = s.initialBackoff
+		}
+		log.Warningf("Proxy process exited, restarting in %v: %v", backoff, err)
+		s.setState(StateBackoff, 0, err)
+
+		select {
+		case <-done:
+			s.setState(StateStopped, 0, nil)
+			return
+		case <-s.after(backoff):
+		}
+		if backoff *= 2; backoff > s.maxBackoff {
+			backoff = s.maxBackoff
+		}
+	}
+}
+
+// runs the proxy process once, returning when it exits or when done is closed.
+func (s *Supervisor) runOnce(done <-chan struct{}) error {
+	s.setState(StateStarting, 0, nil)
+
+	logs, err := newRotatingWriter(s.config.LogFile, s.config.LogMaxBytes, s.config.LogBackups)
+	if err != nil {
+		return fmt.Errorf("failed to open proxy log: %v", err)
+	}
+	defer logs.Close()
+
+	log.Infof("Starting proxy process %v %v", s.config.Exec, s.config.Args)
+	cmd := exec.Command(s.config.Exec, s.config.Args...)
+	cmd.Stdout = logs
+	cmd.Stderr = logs
+	if err := cmd.Start(); err != nil {
+		return fmt.Errorf("failed to start proxy: %v", err)
+	}
+	s.setState(StateRunning, cmd.Process.Pid, nil)
+
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+
+	select {
+	case err := <-exited:
+		if err == nil {
+			err = fmt.Errorf("proxy exited")
+		}
+		return err
+	case <-done:
+		log.V(2).Infof("Cleaning up proxy process...")
+		cmd.Process.Kill()
+		return <-exited
+	}
+}
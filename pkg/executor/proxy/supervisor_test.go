@@ -0,0 +1,104 @@
+package proxy
+
+import (
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestSupervisor returns a supervisor of a shell script that records the
+// backoff delays that it waits out, without actually waiting; done is closed
+// once the given number of delays has been recorded.
+func newTestSupervisor(t *testing.T, script string, delays int) (*Supervisor, *[]time.Duration, chan struct{}) {
+	dir := tempDir(t)
+	s := NewSupervisor(Config{
+		Exec:    "/bin/sh",
+		Args:    []string{"-c", script},
+		LogFile: filepath.Join(dir, "proxy.log"),
+	})
+	s.initialBackoff = 10 * time.Millisecond
+	s.maxBackoff = 40 * time.Millisecond
+	s.stableRunTime = 100 * time.Millisecond
+
+	var lock sync.Mutex
+	recorded := []time.Duration{}
+	done := make(chan struct{})
+	s.after = func(d time.Duration) <-chan time.Time {
+		lock.Lock()
+		defer lock.Unlock()
+		recorded = append(recorded, d)
+		if len(recorded) == delays {
+			close(done)
+		}
+		ch := make(chan time.Time, 1)
+		ch <- time.Now()
+		return ch
+	}
+	return s, &recorded, done
+}
+
+// runs the supervisor until done is closed, failing the test if it doesn't stop
+func runSupervisor(t *testing.T, s *Supervisor, done chan struct{}) {
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		s.Run(done)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(10 * time.Second):
+		t.Fatal("supervisor didn't stop")
+	}
+	os.RemoveAll(filepath.Dir(s.config.LogFile))
+}
+
+func TestSupervisor_Backoff(t *testing.T) {
+	assert := assert.New(t)
+	s, delays, done := newTestSupervisor(t, "echo crashing; exit 1", 5)
+	runSupervisor(t, s, done)
+
+	assert.Equal([]time.Duration{
+		10 * time.Millisecond,
+		20 * time.Millisecond,
+		40 * time.Millisecond,
+		40 * time.Millisecond,
+		40 * time.Millisecond,
+	}, *delays)
+	status := s.Status()
+	assert.Equal(StateStopped, status.State)
+	assert.True(status.Restarts >= 4)
+	assert.NotEmpty(status.LastError)
+}
+
+func TestSupervisor_BackoffResetsAfterStableRun(t *testing.T) {
+	s, delays, done := newTestSupervisor(t, "sleep 0.2; exit 1", 3)
+	runSupervisor(t, s, done)
+
+	for _, d := range *delays {
+		assert.Equal(t, 10*time.Millisecond, d)
+	}
+}
+
+func TestSupervisor_Stop(t *testing.T) {
+	assert := assert.New(t)
+	s, delays, done := newTestSupervisor(t, "exec sleep 60", 1)
+	go func() {
+		for s.Status().State != StateRunning {
+			time.Sleep(10 * time.Millisecond)
+		}
+		close(done)
+	}()
+	start := time.Now()
+	runSupervisor(t, s, done)
+
+	assert.True(time.Since(start) < 10*time.Second, "the proxy process should have been killed")
+	assert.Empty(*delays)
+	status := s.Status()
+	assert.Equal(StateStopped, status.State)
+	assert.Equal(0, status.Restarts)
+	assert.Equal(0, status.Pid)
+}
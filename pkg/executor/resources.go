@@ -0,0 +1,88 @@
+package executor
+
+import (
+	"fmt"
+	"math"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/mesos/mesos-go/mesos"
+)
+
+const (
+	milliCpusPerCpu = 1000
+	bytesPerMB      = 1024 * 1024
+)
+
+// Returns the total cpus and MB of memory that mesos granted to a task.
+func taskResources(resources []*mesos.Resource) (cpus, mem float64) {
+	for _, r := range resources {
+		if r.GetType() != mesos.Value_SCALAR {
+			continue
+		}
+		switch r.GetName() {
+		case "cpus":
+			cpus += r.GetScalar().GetValue()
+		case "mem":
+			mem += r.GetScalar().GetValue()
+		}
+	}
+	return
+}
+
+// applyResourceLimits constrains the containers of the pod to the cpus and memory
+// that mesos granted to the task. Containers that already declare limits keep them;
+// whatever is left of the grant is split evenly across the containers that don't.
+// The kubelet translates the resulting limits into docker CPU shares and memory
+// limits. Returns an error if the pod asks for more than was granted, or if there
+// is nothing left for the containers that don't declare limits. Resources that are
+// missing from the task are not enforced.
+func applyResourceLimits(pod *api.BoundPod, resources []*mesos.Resource) error {
+	cpus, mem := taskResources(resources)
+	if cpus > 0 {
+		// the scheduler sums fractions of cpus, so round rather than truncate
+		granted := int64(math.Floor(cpus*milliCpusPerCpu + 0.5))
+		if err := splitLimit(pod, "cpu", granted,
+			func(c *api.Container) int64 { return int64(c.CPU) },
+			func(c *api.Container, v int64) { c.CPU = int(v) },
+		); err != nil {
+			return err
+		}
+	}
+	if mem > 0 {
+		granted := int64(math.Floor(mem*bytesPerMB + 0.5))
+		if err := splitLimit(pod, "memory", granted,
+			func(c *api.Container) int64 { return int64(c.Memory) },
+			func(c *api.Container, v int64) { c.Memory = int(v) },
+		); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func splitLimit(pod *api.BoundPod, resource string, granted int64, get func(*api.Container) int64, set func(*api.Container, int64)) error {
+	requested := int64(0)
+	unlimited := []*api.Container{}
+	for i := range pod.Spec.Containers {
+		c := &pod.Spec.Containers[i]
+		if v := get(c); v > 0 {
+			requested += v
+		} else {
+			unlimited = append(unlimited, c)
+		}
+	}
+	if requested > granted {
+		return fmt.Errorf("pod requests %d %s but the task was granted %d", requested, resource, granted)
+	}
+	if len(unlimited) == 0 {
+		return nil
+	}
+	share := (granted - requested) / int64(len(unlimited))
+	if share <= 0 {
+		return fmt.Errorf("no %s left of the %d granted to the task for containers without limits", resource, granted)
+	}
+	for _, c := range unlimited {
+		set(c, share)
+	}
+	return nil
+}
@@ -0,0 +1,81 @@
+package executor
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/mesos/mesos-go/mesos"
+	"github.com/stretchr/testify/assert"
+)
+
+// returns a pod with a container for each of the given cpu limits
+func cpuPod(limits ...int) *api.BoundPod {
+	pod := &api.BoundPod{ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: "default"}}
+	for _, cpu := range limits {
+		pod.Spec.Containers = append(pod.Spec.Containers, api.Container{Name: "c", CPU: cpu})
+	}
+	return pod
+}
+
+// returns the cpus that the scheduler grants to the containers: the sum of their
+// limits, as fractions of a cpu
+func grantedCpus(milliCpus ...int) float64 {
+	cpus := 0.0
+	for _, m := range milliCpus {
+		cpus += float64(m) / milliCpusPerCpu
+	}
+	return cpus
+}
+
+func TestApplyResourceLimits_CPU(t *testing.T) {
+	table := []struct {
+		name     string
+		limits   []int
+		cpus     float64
+		expected []int // nil if the pod should be rejected
+	}{
+		{"rounded sum of limits", []int{100, 700}, grantedCpus(100, 700), []int{100, 700}},
+		{"rounded single limit", []int{1001}, grantedCpus(1001), []int{1001}},
+		{"odd fractions", []int{300, 300, 300}, grantedCpus(300, 300, 300), []int{300, 300, 300}},
+		{"default split", []int{500, 0, 0}, grantedCpus(500, 250), []int{500, 125, 125}},
+		{"all unlimited", []int{0, 0}, 0.25, []int{125, 125}},
+		{"over the grant", []int{900}, 0.8, nil},
+		{"nothing left", []int{800, 0}, grantedCpus(800), nil},
+	}
+	for _, tt := range table {
+		pod := cpuPod(tt.limits...)
+		err := applyResourceLimits(pod, []*mesos.Resource{mesos.ScalarResource("cpus", tt.cpus)})
+		if tt.expected == nil {
+			assert.Error(t, err, tt.name)
+			continue
+		}
+		if !assert.NoError(t, err, tt.name) {
+			continue
+		}
+		actual := []int{}
+		for _, c := range pod.Spec.Containers {
+			actual = append(actual, c.CPU)
+		}
+		assert.Equal(t, tt.expected, actual, tt.name)
+	}
+}
+
+func TestApplyResourceLimits_Memory(t *testing.T) {
+	assert := assert.New(t)
+	pod := cpuPod(0, 0, 0)
+	pod.Spec.Containers[0].Memory = 100 * bytesPerMB
+
+	// what the scheduler grants: the limit plus 64MB for each unlimited container
+	mem := float64(100*bytesPerMB)/bytesPerMB + 2*64
+	assert.NoError(applyResourceLimits(pod, []*mesos.Resource{mesos.ScalarResource("mem", mem)}))
+	assert.Equal(100*bytesPerMB, pod.Spec.Containers[0].Memory)
+	assert.Equal(64*bytesPerMB, pod.Spec.Containers[1].Memory)
+	assert.Equal(64*bytesPerMB, pod.Spec.Containers[2].Memory)
+	for _, c := range pod.Spec.Containers {
+		assert.Equal(0, c.CPU, "cpu isn't limited when the task has no cpus")
+	}
+
+	pod = cpuPod(0)
+	pod.Spec.Containers[0].Memory = 65 * bytesPerMB
+	assert.Error(applyResourceLimits(pod, []*mesos.Resource{mesos.ScalarResource("mem", 64)}))
+}
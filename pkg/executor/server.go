@@ -17,12 +17,15 @@ limitations under the License.
 package executor
 
 import (
+	"bufio"
+	"crypto/tls"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"net"
 	"net/http"
+	"net/http/httputil"
 	"net/url"
 	"path"
 	"strconv"
@@ -36,8 +39,10 @@ import (
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet/dockertools"
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/runtime"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/watch"
 	"github.com/golang/glog"
 	"github.com/google/cadvisor/info"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
 	"github.com/mesosphere/kubernetes-mesos/pkg/profile"
 )
 
@@ -46,19 +51,36 @@ type Server struct {
 	host       HostInterface
 	mux        *http.ServeMux
 	sourcename string
+	auth       *authenticator // nil if authentication is disabled
+	adminPaths []string       // path prefixes that require an admin identity
 }
 
 // ListenAndServeKubeletServer initializes a server to respond to HTTP network requests on the Kubelet.
-func ListenAndServeKubeletServer(host HostInterface, address net.IP, port uint, enableDebuggingHandlers bool, sourcename string) error {
+func ListenAndServeKubeletServer(host HostInterface, address net.IP, port uint, enableDebuggingHandlers bool, sourcename string, auth AuthConfig) error {
 	glog.Infof("Starting to listen on %s:%d", address, port)
 	handler := NewServer(host, enableDebuggingHandlers, sourcename)
+	var err error
+	if handler.auth, err = newAuthenticator(auth); err != nil {
+		return err
+	}
 	s := &http.Server{
 		Addr:           net.JoinHostPort(address.String(), strconv.FormatUint(uint64(port), 10)),
-		Handler:        &handler,
+		Handler:        handler,
 		ReadTimeout:    10 * time.Second,
 		WriteTimeout:   10 * time.Second,
 		MaxHeaderBytes: 1 << 20,
 	}
+	if auth.TLSCertFile != "" {
+		if handler.auth != nil && handler.auth.clientCAs != nil {
+			// without ClientCAs, client certificates would be verified against the
+			// system roots
+			s.TLSConfig = &tls.Config{
+				ClientAuth: tls.VerifyClientCertIfGiven,
+				ClientCAs:  handler.auth.clientCAs,
+			}
+		}
+		return s.ListenAndServeTLS(auth.TLSCertFile, auth.TLSKeyFile)
+	}
 	return s.ListenAndServe()
 }
 
@@ -74,9 +96,31 @@ type HostInterface interface {
 	ServeLogs(w http.ResponseWriter, req *http.Request)
 }
 
+// ServiceProxyHost may be implemented by a HostInterface that manages the
+// service proxy, in which case the proxy's status is served at /proxyStatus.
+type ServiceProxyHost interface {
+	// ServiceProxyStatus returns a JSON-serializable snapshot of the proxy's
+	// state, or nil if the host isn't running a proxy.
+	ServiceProxyStatus() interface{}
+}
+
+// Drainer may be implemented by a HostInterface that supports drain mode, in
+// which case draining may be triggered by a POST to /drain and canceled by a
+// POST to /undrain. Both require authentication to be enabled.
+type Drainer interface {
+	Drain()
+	Undrain()
+}
+
+// BoundPodWatcher may be implemented by a HostInterface that can report changes
+// to its bound pods, in which case they are streamed from /watch/boundPods.
+type BoundPodWatcher interface {
+	WatchBoundPods() watch.Interface
+}
+
 // NewServer initializes and configures a kubelet.Server object to handle HTTP requests.
-func NewServer(host HostInterface, enableDebuggingHandlers bool, ns string) Server {
-	server := Server{
+func NewServer(host HostInterface, enableDebuggingHandlers bool, ns string) *Server {
+	server := &Server{
 		host:       host,
 		mux:        http.NewServeMux(),
 		sourcename: ns,
@@ -93,16 +137,56 @@ func (s *Server) InstallDefaultHandlers() {
 	healthz.InstallHandler(s.mux)
 	profile.InstallHandler(s.mux)
 	s.mux.HandleFunc("/podInfo", s.handlePodInfoOld)
-	s.mux.HandleFunc("/api/v1beta1/podInfo", s.handlePodInfoVersioned)
+	s.mux.HandleFunc("/api/", s.handlePodInfoVersioned)
 	s.mux.HandleFunc("/boundPods", s.handleBoundPods)
+	s.mux.HandleFunc("/watch/boundPods", s.handleWatchBoundPods)
 	s.mux.HandleFunc("/stats/", s.handleStats)
+	s.mux.HandleFunc("/podStats/", s.handlePodStats)
 	s.mux.HandleFunc("/spec/", s.handleSpec)
+	s.mux.HandleFunc("/proxyStatus", s.handleProxyStatus)
+	s.handleAdminFunc("/drain", s.handleDrain)
+	s.handleAdminFunc("/undrain", s.handleUndrain)
 }
 
 // InstallDeguggingHandlers registers the HTTP request patterns that serve logs or run commands/containers
 func (s *Server) InstallDebuggingHandlers() {
-	s.mux.HandleFunc("/logs/", s.handleLogs)
-	s.mux.HandleFunc("/containerLogs/", s.handleContainerLogs)
+	s.handleAdminFunc("/logs/", s.handleLogs)
+	s.handleAdminFunc("/containerLogs/", s.handleContainerLogs)
+	s.handleAdminFunc("/exec/", s.handleExec)
+	s.handleAdminFunc("/attach/", s.handleAttach)
+	s.handleAdminFunc("/portForward/", s.handlePortForward)
+}
+
+// handleAdminFunc registers a handler for a pattern that requires an admin identity
+// when authentication is enabled.
+func (s *Server) handleAdminFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	s.adminPaths = append(s.adminPaths, pattern)
+	s.mux.HandleFunc(pattern, handler)
+}
+
+// authorize authenticates the request, if authentication is enabled, and checks that
+// the client may access the requested path. Returns false after writing an error
+// response if the request is denied.
+func (s *Server) authorize(w http.ResponseWriter, req *http.Request) bool {
+	if s.auth == nil || req.URL.Path == "/healthz" {
+		return true
+	}
+	user, ok := s.auth.authenticate(req)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return false
+	}
+	for _, prefix := range s.adminPaths {
+		if req.URL.Path == prefix || (strings.HasSuffix(prefix, "/") && strings.HasPrefix(req.URL.Path, prefix)) {
+			if !s.auth.isAdmin(user) {
+				glog.V(1).Infof("Denied %v access to %v", user, req.URL.Path)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return false
+			}
+			break
+		}
+	}
+	return true
 }
 
 // error serializes an error object into an HTTP response.
@@ -191,22 +275,118 @@ func (s *Server) handleBoundPods(w http.ResponseWriter, req *http.Request) {
 	w.Write(data)
 }
 
+// watchEvent is the JSON form of a watch event, matching the watch encoding of the apiserver.
+type watchEvent struct {
+	Type   watch.EventType `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// handleWatchBoundPods streams an event, one JSON object per line, for each change to
+// the pods bound to the Kubelet. The stream starts with an ADDED event for every
+// pod that is currently bound. The stream ends when the client disconnects or
+// falls behind, in which case it is expected to re-watch.
+func (s *Server) handleWatchBoundPods(w http.ResponseWriter, req *http.Request) {
+	watcher, ok := s.host.(BoundPodWatcher)
+	if !ok {
+		http.Error(w, "Watching bound pods is not supported by this executor", http.StatusNotFound)
+		return
+	}
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		s.error(w, fmt.Errorf("Unable to convert %v into http.Hijacker", w))
+		return
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	defer conn.Close()
+	// watches outlive the read and write timeouts of the server
+	conn.SetDeadline(time.Time{})
+
+	// the client doesn't send anything else, so reads only end when it goes away
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		io.Copy(ioutil.Discard, buf)
+	}()
+
+	podWatch := watcher.WatchBoundPods()
+	defer podWatch.Stop()
+
+	buf.WriteString("HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nTransfer-Encoding: chunked\r\nConnection: close\r\n\r\n")
+	if err := buf.Flush(); err != nil {
+		glog.V(2).Infof("Bound pod watch ended: %v", err)
+		return
+	}
+	chunked := httputil.NewChunkedWriter(buf)
+	defer func() {
+		// the chunked writer doesn't write the CRLF that ends the stream
+		chunked.Close()
+		buf.WriteString("\r\n")
+		buf.Flush()
+	}()
+
+	encoder := json.NewEncoder(chunked)
+	for {
+		select {
+		case <-closed:
+			return
+		case event, ok := <-podWatch.ResultChan():
+			if !ok {
+				// the watch fell behind or was stopped, the client should reconnect
+				return
+			}
+			obj, err := latest.Codec.Encode(event.Object)
+			if err != nil {
+				glog.Errorf("Failed to encode watch event object: %v", err)
+				return
+			}
+			if err := encoder.Encode(&watchEvent{Type: event.Type, Object: json.RawMessage(obj)}); err == nil {
+				err = buf.Flush()
+			}
+			if err != nil {
+				glog.V(2).Infof("Bound pod watch ended: %v", err)
+				return
+			}
+		}
+	}
+}
+
+// handlePodInfoOld serves unversioned pod info, unless an API version is
+// requested with a "version=" query entry.
 func (s *Server) handlePodInfoOld(w http.ResponseWriter, req *http.Request) {
-	s.handlePodInfo(w, req, false)
+	s.handlePodInfo(w, req, req.URL.Query().Get("version"))
 }
 
+// handlePodInfoVersioned serves pod info for requests of the form /api/<version>/podInfo.
 func (s *Server) handlePodInfoVersioned(w http.ResponseWriter, req *http.Request) {
-	s.handlePodInfo(w, req, true)
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/api/"), "/")
+	if len(parts) != 2 || parts[1] != "podInfo" {
+		http.NotFound(w, req)
+		return
+	}
+	s.handlePodInfo(w, req, parts[0])
 }
 
-// handlePodInfo handles podInfo requests against the Kubelet.
-func (s *Server) handlePodInfo(w http.ResponseWriter, req *http.Request, versioned bool) {
+// handlePodInfo handles podInfo requests against the Kubelet. The pod info is
+// encoded with the codec of the given API version, or as plain JSON if the
+// version is empty.
+func (s *Server) handlePodInfo(w http.ResponseWriter, req *http.Request, version string) {
 	req.Close = true
 	u, err := url.ParseRequestURI(req.RequestURI)
 	if err != nil {
 		s.error(w, err)
 		return
 	}
+	var codec runtime.Codec
+	if version != "" {
+		if codec, err = findCodec(version); err != nil {
+			http.Error(w, fmt.Sprintf("Unsupported API version %q, supported versions are %v", version, latest.Versions), http.StatusNotAcceptable)
+			return
+		}
+	}
 	podID := u.Query().Get("podID")
 	podUUID := u.Query().Get("UUID")
 	podNamespace := u.Query().Get("podNamespace")
@@ -237,7 +417,7 @@ func (s *Server) handlePodInfo(w http.ResponseWriter, req *http.Request, version
 		s.error(w, err)
 		return
 	}
-	data, err := exportPodInfo(info, versioned)
+	data, err := exportPodInfo(info, codec)
 	if err != nil {
 		s.error(w, err)
 		return
@@ -252,11 +432,238 @@ func (s *Server) handleStats(w http.ResponseWriter, req *http.Request) {
 	s.serveStats(w, req)
 }
 
+// handlePodStats handles requests for the stats of a pod, aggregated across its
+// containers. These can't be served from /stats/<namespace>/<pod> because that
+// path is already taken by the legacy /stats/<podfullname>/<containerName> route.
+func (s *Server) handlePodStats(w http.ResponseWriter, req *http.Request) {
+	// /podStats/<namespace>/<pod>
+	components := strings.Split(strings.Trim(path.Clean(req.URL.Path), "/"), "/")
+	var query info.ContainerInfoRequest
+	if err := json.NewDecoder(req.Body).Decode(&query); err != nil && err != io.EOF {
+		s.error(w, err)
+		return
+	}
+	switch len(components) {
+	case 3:
+		s.servePodStats(w, components[1], components[2], &query)
+	default:
+		http.Error(w, "unknown resource.", http.StatusNotFound)
+	}
+}
+
 // handleLogs handles logs requests against the Kubelet.
 func (s *Server) handleLogs(w http.ResponseWriter, req *http.Request) {
 	s.host.ServeLogs(w, req)
 }
 
+// handleProxyStatus reports the status of the service proxy run by the executor.
+func (s *Server) handleProxyStatus(w http.ResponseWriter, req *http.Request) {
+	var status interface{}
+	if ph, ok := s.host.(ServiceProxyHost); ok {
+		status = ph.ServiceProxyStatus()
+	}
+	if status == nil {
+		http.Error(w, "Service proxy is not managed by this executor", http.StatusNotFound)
+		return
+	}
+	s.writeJSON(w, status)
+}
+
+// handleDrain puts the executor into drain mode.
+func (s *Server) handleDrain(w http.ResponseWriter, req *http.Request) {
+	if d, ok := s.drainer(w, req, "Drain"); ok {
+		d.Drain()
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// handleUndrain takes the executor out of drain mode.
+func (s *Server) handleUndrain(w http.ResponseWriter, req *http.Request) {
+	if d, ok := s.drainer(w, req, "Undrain"); ok {
+		d.Undrain()
+		w.WriteHeader(http.StatusAccepted)
+	}
+}
+
+// drainer returns the Drainer of the host, writing an error response if the
+// request can't be served. Draining requires authentication: without it anyone
+// who can reach the server could evacuate the slave.
+func (s *Server) drainer(w http.ResponseWriter, req *http.Request, op string) (Drainer, bool) {
+	if req.Method != "POST" {
+		http.Error(w, op+" requires a POST request", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	if s.auth == nil {
+		http.Error(w, op+" requires authentication, see -client_ca_file and -token_auth_file", http.StatusForbidden)
+		return nil, false
+	}
+	d, ok := s.host.(Drainer)
+	if !ok {
+		http.Error(w, "Drain is not supported by this executor", http.StatusNotFound)
+		return nil, false
+	}
+	return d, true
+}
+
+// handleExec runs a command in a pod container.
+// req URI: /exec/<podNamespace>/<podID>/<containerName>?command=<arg>&command=<arg>...[&tty=true]
+func (s *Server) handleExec(w http.ResponseWriter, req *http.Request) {
+	cmd := req.URL.Query()["command"]
+	if len(cmd) == 0 {
+		http.Error(w, "Missing 'command=' query entry.", http.StatusBadRequest)
+		return
+	}
+	s.serveContainerStream(w, req, "/exec/", func(streamer ContainerStreamer, podFullName, uuid, container string, conn io.ReadWriter, tty bool) error {
+		return streamer.ExecInContainer(podFullName, uuid, container, cmd, conn, conn, conn, tty)
+	})
+}
+
+// handleAttach attaches to the primary process of a pod container.
+// req URI: /attach/<podNamespace>/<podID>/<containerName>[?tty=true]
+func (s *Server) handleAttach(w http.ResponseWriter, req *http.Request) {
+	s.serveContainerStream(w, req, "/attach/", func(streamer ContainerStreamer, podFullName, uuid, container string, conn io.ReadWriter, tty bool) error {
+		return streamer.AttachContainer(podFullName, uuid, container, conn, conn, conn, tty)
+	})
+}
+
+// serveContainerStream upgrades the connection of an exec or attach request to a
+// raw stream that carries the container's stdin and, merged, its stdout and stderr.
+func (s *Server) serveContainerStream(w http.ResponseWriter, req *http.Request, prefix string, f func(ContainerStreamer, string, string, string, io.ReadWriter, bool) error) {
+	streamer, ok := s.streamer(w, req)
+	if !ok {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, prefix), "/")
+	if len(parts) != 3 || parts[0] == "" || parts[1] == "" || parts[2] == "" {
+		http.Error(w, "Unexpected path, expected "+prefix+"<podNamespace>/<podID>/<containerName>", http.StatusBadRequest)
+		return
+	}
+	pod, found, err := s.findBoundPod(parts[0], parts[1])
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	if !found {
+		http.Error(w, "Pod does not exist", http.StatusNotFound)
+		return
+	}
+	if !hasContainer(pod, parts[2]) {
+		http.Error(w, "Container does not exist", http.StatusNotFound)
+		return
+	}
+	tty, _ := strconv.ParseBool(req.URL.Query().Get("tty"))
+	conn, ok := s.upgrade(w)
+	if !ok {
+		return
+	}
+	defer conn.Close()
+	if err := f(streamer, kubelet.GetPodFullName(pod), pod.UID, parts[2], conn, tty); err != nil {
+		glog.Errorf("Stream to container %v of pod %v/%v failed: %v", parts[2], pod.Namespace, pod.Name, err)
+	}
+}
+
+// handlePortForward forwards the connection to a port in the network namespace of a pod.
+// req URI: /portForward/<podNamespace>/<podID>?port=<port>
+func (s *Server) handlePortForward(w http.ResponseWriter, req *http.Request) {
+	streamer, ok := s.streamer(w, req)
+	if !ok {
+		return
+	}
+	parts := strings.Split(strings.TrimPrefix(req.URL.Path, "/portForward/"), "/")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		http.Error(w, "Unexpected path, expected /portForward/<podNamespace>/<podID>", http.StatusBadRequest)
+		return
+	}
+	port, err := strconv.ParseUint(req.URL.Query().Get("port"), 10, 16)
+	if err != nil || port == 0 {
+		http.Error(w, "Missing or invalid 'port=' query entry.", http.StatusBadRequest)
+		return
+	}
+	pod, found, err := s.findBoundPod(parts[0], parts[1])
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	if !found {
+		http.Error(w, "Pod does not exist", http.StatusNotFound)
+		return
+	}
+	conn, ok := s.upgrade(w)
+	if !ok {
+		return
+	}
+	if err := streamer.PortForward(kubelet.GetPodFullName(pod), pod.UID, uint16(port), conn); err != nil {
+		glog.Errorf("Port forward to %v/%v:%d failed: %v", pod.Namespace, pod.Name, port, err)
+	}
+}
+
+// streamer returns the ContainerStreamer of the host, writing an error response
+// if the request can't be served.
+func (s *Server) streamer(w http.ResponseWriter, req *http.Request) (ContainerStreamer, bool) {
+	if req.Method != "POST" {
+		http.Error(w, "Streaming requires a POST request", http.StatusMethodNotAllowed)
+		return nil, false
+	}
+	streamer, ok := s.host.(ContainerStreamer)
+	if !ok {
+		http.Error(w, "Streaming is not supported by this executor", http.StatusNotFound)
+		return nil, false
+	}
+	if req.Header.Get("Upgrade") == "" {
+		// only requests that ask for an upgrade bypass the request logger, which
+		// can't be hijacked
+		http.Error(w, "Streaming requires 'Connection: Upgrade' and 'Upgrade: tcp' headers", http.StatusBadRequest)
+		return nil, false
+	}
+	return streamer, true
+}
+
+func hasContainer(pod *api.BoundPod, name string) bool {
+	for _, c := range pod.Spec.Containers {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// upgrade hijacks the connection of the request and switches it to a raw,
+// bidirectional stream. Clients should send "Connection: Upgrade" and
+// "Upgrade: tcp" headers.
+func (s *Server) upgrade(w http.ResponseWriter) (net.Conn, bool) {
+	hj, ok := w.(http.Hijacker)
+	if !ok {
+		s.error(w, fmt.Errorf("Unable to convert %v into http.Hijacker", w))
+		return nil, false
+	}
+	conn, buf, err := hj.Hijack()
+	if err != nil {
+		s.error(w, err)
+		return nil, false
+	}
+	// streams outlive the read and write timeouts of the server
+	conn.SetDeadline(time.Time{})
+	conn = &hijackedConn{Conn: conn, reader: buf.Reader}
+	buf.WriteString("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+	if err := buf.Flush(); err != nil {
+		glog.Errorf("Failed to upgrade connection: %v", err)
+		conn.Close()
+		return nil, false
+	}
+	return conn, true
+}
+
+// hijackedConn reads through the buffer of the hijacked connection, which may
+// already hold data sent by the client.
+type hijackedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (c *hijackedConn) Read(p []byte) (int, error) {
+	return c.reader.Read(p)
+}
+
 // handleSpec handles spec requests against the Kubelet.
 func (s *Server) handleSpec(w http.ResponseWriter, req *http.Request) {
 	info, err := s.host.GetMachineInfo()
@@ -276,6 +683,14 @@ func (s *Server) handleSpec(w http.ResponseWriter, req *http.Request) {
 
 // ServeHTTP responds to HTTP requests on the Kubelet.
 func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Header.Get("Upgrade") != "" || req.URL.Path == "/watch/boundPods" {
+		// the request logger can't be hijacked, so streaming requests and watches bypass it
+		glog.V(2).Infof("%s %s: streaming, upgrade %q", req.Method, req.RequestURI, req.Header.Get("Upgrade"))
+		if s.authorize(w, req) {
+			s.mux.ServeHTTP(w, req)
+		}
+		return
+	}
 	defer httplog.NewLogged(req, &w).StacktraceWhen(
 		httplog.StatusIsNot(
 			http.StatusOK,
@@ -284,12 +699,16 @@ func (s *Server) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 			http.StatusNotFound,
 		),
 	).Log()
+	if !s.authorize(w, req) {
+		return
+	}
 	s.mux.ServeHTTP(w, req)
 }
 
 // serveStats implements stats logic.
 func (s *Server) serveStats(w http.ResponseWriter, req *http.Request) {
-	// /stats/<podfullname>/<containerName> or /stats/<namespace>/<podfullname>/<uuid>/<containerName>
+	// /stats/summary, /stats/<podfullname>/<containerName> or
+	// /stats/<namespace>/<podfullname>/<uuid>/<containerName>
 	components := strings.Split(strings.TrimPrefix(path.Clean(req.URL.Path), "/"), "/")
 	var stats *info.ContainerInfo
 	var err error
@@ -304,9 +723,13 @@ func (s *Server) serveStats(w http.ResponseWriter, req *http.Request) {
 		// Machine stats
 		stats, err = s.host.GetRootInfo(&query)
 	case 2:
-		// pod stats
-		// TODO(monnand) Implement this
-		errors.New("pod level status currently unimplemented")
+		if components[1] != "summary" {
+			http.Error(w, "unknown resource.", http.StatusNotFound)
+			return
+		}
+		// resource usage of every pod
+		s.serveStatsSummary(w, &query)
+		return
 	case 3:
 		// Backward compatibility without uuid information
 		podFullName := kubelet.GetPodFullName(&api.BoundPod{
@@ -350,13 +773,83 @@ func (s *Server) serveStats(w http.ResponseWriter, req *http.Request) {
 	return
 }
 
-func exportPodInfo(info api.PodInfo, versioned bool) ([]byte, error) {
-	if versioned {
-		// TODO: support arbitrary versions here
-		codec, err := findCodec("v1beta1")
+// servePodStats responds with the aggregated stats of all containers of a pod.
+func (s *Server) servePodStats(w http.ResponseWriter, namespace, name string, query *info.ContainerInfoRequest) {
+	pod, found, err := s.findBoundPod(namespace, name)
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	if !found {
+		http.Error(w, "Pod does not exist", http.StatusNotFound)
+		return
+	}
+	stats, err := GetPodStats(s.host, pod, query)
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	s.writeJSON(w, stats)
+}
+
+// serveStatsSummary responds with the resource usage of every pod bound to the Kubelet.
+func (s *Server) serveStatsSummary(w http.ResponseWriter, query *info.ContainerInfoRequest) {
+	pods, err := s.host.GetBoundPods()
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	if query.NumStats < 2 {
+		// we need at least two samples to calculate cpu usage
+		query.NumStats = 2
+	}
+	summary := []messages.PodUsage{}
+	for i := range pods {
+		pod := &pods[i]
+		stats, err := GetPodStats(s.host, pod, query)
 		if err != nil {
-			return nil, err
+			glog.V(2).Infof("Failed to collect stats for pod %v/%v: %v", pod.Namespace, pod.Name, err)
+			continue
 		}
+		summary = append(summary, messages.PodUsage{
+			Namespace: pod.Namespace,
+			Name:      pod.Name,
+			UID:       pod.UID,
+			Usage:     stats.Usage,
+		})
+	}
+	s.writeJSON(w, summary)
+}
+
+// findBoundPod looks up the pod with the given namespace and name among the pods bound to the Kubelet.
+func (s *Server) findBoundPod(namespace, name string) (*api.BoundPod, bool, error) {
+	pods, err := s.host.GetBoundPods()
+	if err != nil {
+		return nil, false, err
+	}
+	for i := range pods {
+		if pods[i].Namespace == namespace && pods[i].Name == name {
+			return &pods[i], true, nil
+		}
+	}
+	return nil, false, nil
+}
+
+// writeJSON serializes obj as the JSON body of a successful HTTP response.
+func (s *Server) writeJSON(w http.ResponseWriter, obj interface{}) {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		s.error(w, err)
+		return
+	}
+	w.Header().Add("Content-type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	w.Write(data)
+}
+
+// exportPodInfo serializes info with the given codec, or as plain JSON if codec is nil.
+func exportPodInfo(info api.PodInfo, codec runtime.Codec) ([]byte, error) {
+	if codec != nil {
 		return codec.Encode(&api.PodContainerInfo{ContainerInfo: info})
 	}
 	return json.Marshal(info)
@@ -0,0 +1,363 @@
+package executor
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/latest"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet"
+	"github.com/google/cadvisor/info"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeHost serves a fixed set of bound pods, whose containers all report the
+// same cAdvisor samples.
+type fakeHost struct {
+	pods    []api.BoundPod
+	podInfo api.PodInfo
+	samples []*info.ContainerStats
+}
+
+func (h *fakeHost) GetContainerInfo(podFullName, uuid, containerName string, req *info.ContainerInfoRequest) (*info.ContainerInfo, error) {
+	for i := range h.pods {
+		if kubelet.GetPodFullName(&h.pods[i]) == podFullName {
+			return containerInfo(h.samples...), nil
+		}
+	}
+	return nil, errors.New("no such container")
+}
+
+func (h *fakeHost) GetRootInfo(req *info.ContainerInfoRequest) (*info.ContainerInfo, error) {
+	return containerInfo(h.samples...), nil
+}
+
+func (h *fakeHost) GetMachineInfo() (*info.MachineInfo, error) {
+	return &info.MachineInfo{NumCores: 4}, nil
+}
+
+func (h *fakeHost) GetBoundPods() ([]api.BoundPod, error) {
+	return h.pods, nil
+}
+
+func (h *fakeHost) GetPodInfo(name, uuid string) (api.PodInfo, error) {
+	return h.podInfo, nil
+}
+
+func (h *fakeHost) GetKubeletContainerLogs(podFullName, containerName, tail string, follow bool, stdout, stderr io.Writer) error {
+	return nil
+}
+
+func (h *fakeHost) ServeLogs(w http.ResponseWriter, req *http.Request) {}
+
+// starts a server for the given host, with the debugging handlers enabled
+func newTestServer(host HostInterface) *httptest.Server {
+	return httptest.NewServer(NewServer(host, true, "k8sm"))
+}
+
+func newFakeHost() *fakeHost {
+	pod := api.BoundPod{
+		ObjectMeta: api.ObjectMeta{
+			Name:        "foo",
+			Namespace:   "default",
+			UID:         "uid-1",
+			Annotations: map[string]string{kubelet.ConfigSourceAnnotationKey: "k8sm"},
+		},
+		Spec: api.PodSpec{Containers: []api.Container{{Name: "web", Image: "nginx"}}},
+	}
+	return &fakeHost{
+		pods: []api.BoundPod{pod},
+		samples: []*info.ContainerStats{
+			sample(0, 0, 10, 5, 0, 0),
+			sample(time.Second, 1e8, 10, 5, 0, 0),
+		},
+	}
+}
+
+func TestServer_StatsSummary(t *testing.T) {
+	assert := assert.New(t)
+	srv := newTestServer(newFakeHost())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/stats/summary")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	summary := []messages.PodUsage{}
+	assert.NoError(json.NewDecoder(resp.Body).Decode(&summary))
+	if assert.Len(summary, 1) {
+		assert.Equal("default", summary[0].Namespace)
+		assert.Equal("foo", summary[0].Name)
+		assert.Equal("uid-1", summary[0].UID)
+	}
+
+	// other two part paths remain unknown
+	resp, err = http.Get(srv.URL + "/stats/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(http.StatusNotFound, resp.StatusCode)
+}
+
+func TestServer_PodStats(t *testing.T) {
+	assert := assert.New(t)
+	srv := newTestServer(newFakeHost())
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/podStats/default/foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	stats := &PodStats{}
+	assert.NoError(json.NewDecoder(resp.Body).Decode(stats))
+	assert.Equal("foo", stats.Name)
+	assert.NotNil(stats.Containers["web"])
+
+	for _, path := range []string{"/podStats/default/bar", "/podStats/", "/podStats/default"} {
+		resp, err := http.Get(srv.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		assert.Equal(http.StatusNotFound, resp.StatusCode, path)
+	}
+}
+
+func getJSON(t *testing.T, url string, obj interface{}) int {
+	resp, err := http.Get(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusOK {
+		assert.NoError(t, json.NewDecoder(resp.Body).Decode(obj), url)
+	}
+	return resp.StatusCode
+}
+
+func TestServer_PodInfoVersions(t *testing.T) {
+	assert := assert.New(t)
+	host := newFakeHost()
+	host.podInfo = api.PodInfo{"web": api.ContainerStatus{RestartCount: 1, Image: "nginx"}}
+	srv := newTestServer(host)
+	defer srv.Close()
+	query := "podID=foo&podNamespace=default"
+
+	// the original format remains the default
+	info := api.PodInfo{}
+	assert.Equal(http.StatusOK, getJSON(t, srv.URL+"/podInfo?"+query, &info))
+	assert.Equal(host.podInfo, info)
+
+	for _, version := range latest.Versions {
+		for _, url := range []string{
+			srv.URL + "/api/" + version + "/podInfo?" + query,
+			srv.URL + "/podInfo?version=" + version + "&" + query,
+		} {
+			versioned := map[string]interface{}{}
+			if assert.Equal(http.StatusOK, getJSON(t, url, &versioned), url) {
+				assert.Equal(version, versioned["apiVersion"], url)
+				assert.Equal("PodContainerInfo", versioned["kind"], url)
+				assert.NotNil(versioned["containerInfo"], url)
+			}
+		}
+	}
+
+	for _, url := range []string{
+		srv.URL + "/api/v0/podInfo?" + query,
+		srv.URL + "/podInfo?version=v0&" + query,
+	} {
+		assert.Equal(http.StatusNotAcceptable, getJSON(t, url, nil), url)
+	}
+	assert.Equal(http.StatusNotFound, getJSON(t, srv.URL+"/api/"+latest.Version+"/boundPods", nil))
+}
+
+// drainHost records drain requests
+type drainHost struct {
+	fakeHost
+	draining bool
+}
+
+func (h *drainHost) Drain()   { h.draining = true }
+func (h *drainHost) Undrain() { h.draining = false }
+
+func post(t *testing.T, url, token string) int {
+	req, _ := http.NewRequest("POST", url, nil)
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp.StatusCode
+}
+
+func TestServer_DrainRequiresAuthentication(t *testing.T) {
+	assert := assert.New(t)
+	host := &drainHost{fakeHost: *newFakeHost()}
+	s := NewServer(host, false, "k8sm")
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	assert.Equal(http.StatusForbidden, post(t, srv.URL+"/drain", ""))
+	assert.False(host.draining)
+
+	s.auth = &authenticator{
+		tokens: map[string]string{"admin-token": "root", "user-token": "alice"},
+		admins: map[string]bool{"root": true},
+	}
+	assert.Equal(http.StatusUnauthorized, post(t, srv.URL+"/drain", ""))
+	assert.Equal(http.StatusForbidden, post(t, srv.URL+"/drain", "user-token"))
+	assert.False(host.draining)
+	assert.Equal(http.StatusAccepted, post(t, srv.URL+"/drain", "admin-token"))
+	assert.True(host.draining)
+	assert.Equal(http.StatusAccepted, post(t, srv.URL+"/undrain", "admin-token"))
+	assert.False(host.draining)
+
+	req, _ := http.NewRequest("GET", srv.URL+"/drain", nil)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	assert.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+// streamHost answers each stream with a line describing what was requested
+type streamHost struct {
+	fakeHost
+}
+
+func (h *streamHost) ExecInContainer(podFullName, uuid, container string, cmd []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
+	fmt.Fprintf(stdout, "exec %s %s %s %v tty=%v\n", podFullName, uuid, container, cmd, tty)
+	return nil
+}
+
+func (h *streamHost) AttachContainer(podFullName, uuid, container string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
+	fmt.Fprintf(stdout, "attach %s %s %s tty=%v\n", podFullName, uuid, container, tty)
+	return nil
+}
+
+func (h *streamHost) PortForward(podFullName, uuid string, port uint16, stream io.ReadWriteCloser) error {
+	defer stream.Close()
+	fmt.Fprintf(stream, "forward %s %s %d\n", podFullName, uuid, port)
+	return nil
+}
+
+func TestServer_StreamingErrors(t *testing.T) {
+	srv := newTestServer(&streamHost{fakeHost: *newFakeHost()})
+	defer srv.Close()
+
+	table := []struct {
+		method, path string
+		upgrade      bool
+		expected     int
+	}{
+		{"GET", "/exec/default/foo/web?command=ls", true, http.StatusMethodNotAllowed},
+		{"POST", "/exec/default/foo/web?command=ls", false, http.StatusBadRequest},
+		{"POST", "/exec/default/foo/web", true, http.StatusBadRequest},
+		{"POST", "/exec/default/foo?command=ls", true, http.StatusBadRequest},
+		{"POST", "/exec/default/foo/web/x?command=ls", true, http.StatusBadRequest},
+		{"POST", "/exec/default/bar/web?command=ls", true, http.StatusNotFound},
+		{"POST", "/exec/default/foo/db?command=ls", true, http.StatusNotFound},
+		{"GET", "/attach/default/foo/web", true, http.StatusMethodNotAllowed},
+		{"POST", "/attach/default/foo/web", false, http.StatusBadRequest},
+		{"POST", "/attach/default/foo", true, http.StatusBadRequest},
+		{"POST", "/attach/other/foo/web", true, http.StatusNotFound},
+		{"POST", "/attach/default/foo/db", true, http.StatusNotFound},
+		{"GET", "/portForward/default/foo?port=80", true, http.StatusMethodNotAllowed},
+		{"POST", "/portForward/default/foo?port=80", false, http.StatusBadRequest},
+		{"POST", "/portForward/default/foo", true, http.StatusBadRequest},
+		{"POST", "/portForward/default/foo?port=70000", true, http.StatusBadRequest},
+		{"POST", "/portForward/default/foo/web?port=80", true, http.StatusBadRequest},
+		{"POST", "/portForward/default/bar?port=80", true, http.StatusNotFound},
+	}
+	for _, tt := range table {
+		req, _ := http.NewRequest(tt.method, srv.URL+tt.path, nil)
+		if tt.upgrade {
+			req.Header.Set("Connection", "Upgrade")
+			req.Header.Set("Upgrade", "tcp")
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		assert.Equal(t, tt.expected, resp.StatusCode, "%s %s upgrade=%v", tt.method, tt.path, tt.upgrade)
+	}
+}
+
+func TestServer_StreamingNotSupported(t *testing.T) {
+	srv := newTestServer(newFakeHost())
+	defer srv.Close()
+
+	for _, path := range []string{"/exec/default/foo/web?command=ls", "/attach/default/foo/web", "/portForward/default/foo?port=80"} {
+		req, _ := http.NewRequest("POST", srv.URL+path, nil)
+		req.Header.Set("Connection", "Upgrade")
+		req.Header.Set("Upgrade", "tcp")
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode, path)
+	}
+}
+
+// sends an upgrade request over a raw connection and returns everything that the
+// server streams back after switching protocols
+func upgradeRequest(t *testing.T, srv *httptest.Server, path string) string {
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	req, _ := http.NewRequest("POST", srv.URL+path, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	if err := req.Write(conn); err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, http.StatusSwitchingProtocols, resp.StatusCode, path)
+	assert.Equal(t, "tcp", resp.Header.Get("Upgrade"), path)
+	data, err := ioutil.ReadAll(reader)
+	assert.NoError(t, err, path)
+	return string(data)
+}
+
+func TestServer_StreamingUpgrade(t *testing.T) {
+	assert := assert.New(t)
+	srv := newTestServer(&streamHost{fakeHost: *newFakeHost()})
+	defer srv.Close()
+
+	assert.Equal("exec foo.default.k8sm uid-1 web [ls -l] tty=true\n",
+		upgradeRequest(t, srv, "/exec/default/foo/web?command=ls&command=-l&tty=true"))
+	assert.Equal("attach foo.default.k8sm uid-1 web tty=false\n",
+		upgradeRequest(t, srv, "/attach/default/foo/web"))
+	assert.Equal("forward foo.default.k8sm uid-1 8080\n",
+		upgradeRequest(t, srv, "/portForward/default/foo?port=8080"))
+}
@@ -0,0 +1,90 @@
+package executor
+
+import (
+	"time"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet"
+	"github.com/google/cadvisor/info"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
+)
+
+// ContainerInfoGetter is the subset of kubelet functionality needed to
+// gather cAdvisor stats for the containers of a pod.
+type ContainerInfoGetter interface {
+	GetContainerInfo(podFullName, uuid, containerName string, req *info.ContainerInfoRequest) (*info.ContainerInfo, error)
+}
+
+// PodStats holds the cAdvisor stats of every container in a pod, along with
+// the usage aggregated across all of them.
+type PodStats struct {
+	Namespace  string                         `json:"namespace"`
+	Name       string                         `json:"name"`
+	UID        string                         `json:"uid,omitempty"`
+	Containers map[string]*info.ContainerInfo `json:"containers"`
+	Usage      messages.ResourceUsage         `json:"usage"`
+}
+
+// GetPodStats collects cAdvisor stats for all containers of the given pod,
+// including its network container. Containers for which no stats are available
+// (for example because they haven't started yet) are skipped.
+func GetPodStats(getter ContainerInfoGetter, pod *api.BoundPod, req *info.ContainerInfoRequest) (*PodStats, error) {
+	podFullName := kubelet.GetPodFullName(pod)
+	names := []string{networkContainerName}
+	for _, c := range pod.Spec.Containers {
+		names = append(names, c.Name)
+	}
+
+	stats := &PodStats{
+		Namespace:  pod.Namespace,
+		Name:       pod.Name,
+		UID:        pod.UID,
+		Containers: make(map[string]*info.ContainerInfo),
+	}
+	var lastErr error
+	for _, name := range names {
+		ci, err := getter.GetContainerInfo(podFullName, pod.UID, name, req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		if ci != nil {
+			stats.Containers[name] = ci
+		}
+	}
+	if len(stats.Containers) == 0 && lastErr != nil {
+		return nil, lastErr
+	}
+	stats.Usage = aggregateUsage(stats.Containers)
+	return stats, nil
+}
+
+// Sums the most recent CPU and memory samples of the given containers. Network
+// usage is taken from the network container since all pod containers share its
+// network namespace.
+func aggregateUsage(containers map[string]*info.ContainerInfo) (usage messages.ResourceUsage) {
+	for name, ci := range containers {
+		n := len(ci.Stats)
+		if n == 0 || ci.Stats[n-1] == nil {
+			continue
+		}
+		latest := ci.Stats[n-1]
+		if latest.Timestamp.After(usage.Timestamp) {
+			usage.Timestamp = latest.Timestamp
+		}
+		usage.CpuTotal += latest.Cpu.Usage.Total
+		if n > 1 && ci.Stats[n-2] != nil {
+			prev := ci.Stats[n-2]
+			if elapsed := latest.Timestamp.Sub(prev.Timestamp); elapsed > 0 && latest.Cpu.Usage.Total >= prev.Cpu.Usage.Total {
+				usage.Cpus += float64(latest.Cpu.Usage.Total-prev.Cpu.Usage.Total) / float64(elapsed/time.Nanosecond)
+			}
+		}
+		usage.MemoryUsage += latest.Memory.Usage
+		usage.MemoryWorkingSet += latest.Memory.WorkingSet
+		if name == networkContainerName {
+			usage.NetworkRxBytes = latest.Network.RxBytes
+			usage.NetworkTxBytes = latest.Network.TxBytes
+		}
+	}
+	return
+}
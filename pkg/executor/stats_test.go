@@ -0,0 +1,100 @@
+package executor
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/cadvisor/info"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+var statsEpoch = time.Date(2015, 1, 1, 0, 0, 0, 0, time.UTC)
+
+// returns a cAdvisor sample taken at the given offset from statsEpoch
+func sample(offset time.Duration, cpuTotal, memUsage, workingSet, rx, tx uint64) *info.ContainerStats {
+	s := &info.ContainerStats{Timestamp: statsEpoch.Add(offset)}
+	s.Cpu.Usage.Total = cpuTotal
+	s.Memory.Usage = memUsage
+	s.Memory.WorkingSet = workingSet
+	s.Network.RxBytes = rx
+	s.Network.TxBytes = tx
+	return s
+}
+
+func containerInfo(samples ...*info.ContainerStats) *info.ContainerInfo {
+	return &info.ContainerInfo{Stats: samples}
+}
+
+func TestAggregateUsage(t *testing.T) {
+	table := []struct {
+		name       string
+		containers map[string]*info.ContainerInfo
+		expected   messages.ResourceUsage
+	}{
+		{
+			name:       "no containers",
+			containers: map[string]*info.ContainerInfo{},
+		},
+		{
+			name: "no samples",
+			containers: map[string]*info.ContainerInfo{
+				"web": containerInfo(),
+			},
+		},
+		{
+			name: "single sample yields no cpu rate",
+			containers: map[string]*info.ContainerInfo{
+				"web": containerInfo(sample(time.Second, 5e8, 100, 80, 0, 0)),
+			},
+			expected: messages.ResourceUsage{
+				Timestamp:        statsEpoch.Add(time.Second),
+				CpuTotal:         5e8,
+				MemoryUsage:      100,
+				MemoryWorkingSet: 80,
+			},
+		},
+		{
+			name: "sums containers, network from the network container only",
+			containers: map[string]*info.ContainerInfo{
+				networkContainerName: containerInfo(
+					sample(0, 0, 10, 10, 1000, 2000),
+					sample(time.Second, 0, 10, 10, 3000, 4000),
+				),
+				"web": containerInfo(
+					sample(0, 1e9, 100, 80, 7, 7),
+					sample(time.Second, 2e9, 200, 160, 7, 7),
+				),
+				"db": containerInfo(
+					sample(0, 0, 300, 200, 9, 9),
+					sample(2*time.Second, 1e9, 400, 300, 9, 9),
+				),
+			},
+			expected: messages.ResourceUsage{
+				Timestamp:        statsEpoch.Add(2 * time.Second),
+				CpuTotal:         3e9,
+				Cpus:             1.5,
+				MemoryUsage:      610,
+				MemoryWorkingSet: 470,
+				NetworkRxBytes:   3000,
+				NetworkTxBytes:   4000,
+			},
+		},
+		{
+			name: "cpu counter reset yields no cpu rate",
+			containers: map[string]*info.ContainerInfo{
+				"web": containerInfo(
+					sample(0, 2e9, 0, 0, 0, 0),
+					sample(time.Second, 1e9, 0, 0, 0, 0),
+				),
+			},
+			expected: messages.ResourceUsage{
+				Timestamp: statsEpoch.Add(time.Second),
+				CpuTotal:  1e9,
+			},
+		},
+	}
+	for _, tt := range table {
+		assert.Equal(t, tt.expected, aggregateUsage(tt.containers), tt.name)
+	}
+}
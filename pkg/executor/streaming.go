@@ -0,0 +1,137 @@
+package executor
+
+import (
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/kubelet/dockertools"
+	"github.com/fsouza/go-dockerclient"
+	"github.com/golang/glog"
+)
+
+// ContainerStreamer may be implemented by a HostInterface that supports
+// interactive access to pod containers, in which case the /exec, /attach and
+// /portForward debugging endpoints are served.
+type ContainerStreamer interface {
+	// ExecInContainer runs cmd in the named container of the pod, connecting
+	// its stdio to the given streams. Blocks until the command exits.
+	ExecInContainer(podFullName, uuid, container string, cmd []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error
+	// AttachContainer connects the given streams to the stdio of the primary
+	// process of the named container. Blocks until the process exits or the
+	// streams are closed.
+	AttachContainer(podFullName, uuid, container string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error
+	// PortForward copies data between stream and the given port of the pod's
+	// network namespace. Blocks until either side closes the connection.
+	PortForward(podFullName, uuid string, port uint16, stream io.ReadWriteCloser) error
+}
+
+// DockerStreamer implements ContainerStreamer using the docker remote API.
+type DockerStreamer struct {
+	client *docker.Client
+}
+
+func NewDockerStreamer(client *docker.Client) *DockerStreamer {
+	return &DockerStreamer{client: client}
+}
+
+// find the docker ID of the named container of a pod
+func (d *DockerStreamer) findContainer(podFullName, uuid, container string) (string, error) {
+	containers, err := dockertools.GetKubeletDockerContainers(d.client, false)
+	if err != nil {
+		return "", err
+	}
+	if c, found, _ := containers.FindPodContainer(podFullName, uuid, container); found {
+		return c.ID, nil
+	}
+	return "", fmt.Errorf("container %q not found in pod %q", container, podFullName)
+}
+
+func (d *DockerStreamer) ExecInContainer(podFullName, uuid, container string, cmd []string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
+	id, err := d.findContainer(podFullName, uuid, container)
+	if err != nil {
+		return err
+	}
+	execObj, err := d.client.CreateExec(docker.CreateExecOptions{
+		Container:    id,
+		Cmd:          cmd,
+		AttachStdin:  stdin != nil,
+		AttachStdout: stdout != nil,
+		AttachStderr: stderr != nil,
+		Tty:          tty,
+	})
+	if err != nil {
+		return err
+	}
+	glog.V(2).Infof("Executing %v in container %v of pod %v", cmd, container, podFullName)
+	return d.client.StartExec(execObj.ID, docker.StartExecOptions{
+		InputStream:  stdin,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+		Tty:          tty,
+		RawTerminal:  tty,
+	})
+}
+
+func (d *DockerStreamer) AttachContainer(podFullName, uuid, container string, stdin io.Reader, stdout, stderr io.Writer, tty bool) error {
+	id, err := d.findContainer(podFullName, uuid, container)
+	if err != nil {
+		return err
+	}
+	glog.V(2).Infof("Attaching to container %v of pod %v", container, podFullName)
+	return d.client.AttachToContainer(docker.AttachToContainerOptions{
+		Container:    id,
+		InputStream:  stdin,
+		OutputStream: stdout,
+		ErrorStream:  stderr,
+		Stream:       true,
+		Stdin:        stdin != nil,
+		Stdout:       stdout != nil,
+		Stderr:       stderr != nil,
+		RawTerminal:  tty,
+	})
+}
+
+// PortForward enters the network namespace of the pod's network container and
+// relays the stream to the port with socat, so both nsenter and socat must be
+// installed on the host.
+func (d *DockerStreamer) PortForward(podFullName, uuid string, port uint16, stream io.ReadWriteCloser) error {
+	id, err := d.findContainer(podFullName, uuid, networkContainerName)
+	if err != nil {
+		return err
+	}
+	container, err := d.client.InspectContainer(id)
+	if err != nil {
+		return err
+	}
+	if !container.State.Running {
+		return fmt.Errorf("network container of pod %q is not running", podFullName)
+	}
+	cmd := exec.Command("nsenter", "-t", strconv.Itoa(container.State.Pid), "-n",
+		"socat", "-", "TCP4:localhost:"+strconv.Itoa(int(port)))
+	cmd.Stdout = stream
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	glog.V(2).Infof("Forwarding to port %d of pod %v", port, podFullName)
+
+	// socat exits when the pod side closes; closing its stdin signals that the
+	// client side has gone away
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		io.Copy(stdin, stream)
+		stdin.Close()
+	}()
+	err = cmd.Wait()
+	stream.Close()
+	wg.Wait()
+	return err
+}
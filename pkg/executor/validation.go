@@ -0,0 +1,103 @@
+package executor
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api/validation"
+	"github.com/mesos/mesos-go/mesos"
+)
+
+// validatePod checks a pod received in a LaunchTask request before it is handed
+// to the kubelet. Host paths are cleaned as a side effect. Returns an error that
+// describes the first problem found, if any.
+func (k *KubernetesExecutor) validatePod(pod *api.BoundPod, taskInfo *mesos.TaskInfo) error {
+	if pod.Name == "" {
+		return fmt.Errorf("pod name is required")
+	}
+	if pod.Namespace == "" {
+		return fmt.Errorf("pod %q: namespace is required", pod.Name)
+	}
+	if errs := validation.ValidateBoundPod(pod); len(errs) > 0 {
+		msgs := make([]string, 0, len(errs))
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		return fmt.Errorf("pod %q is invalid: %s", pod.Name, strings.Join(msgs, "; "))
+	}
+	return k.checkPodPolicy(pod, taskInfo)
+}
+
+// checkPodPolicy checks that a valid pod only asks for what this slave allows and
+// what mesos granted to the task. Host paths are cleaned as a side effect.
+func (k *KubernetesExecutor) checkPodPolicy(pod *api.BoundPod, taskInfo *mesos.TaskInfo) error {
+	if err := validateHostPorts(pod, taskInfo.GetResources()); err != nil {
+		return err
+	}
+	for _, c := range pod.Spec.Containers {
+		if c.Privileged && !k.allowPrivileged {
+			return fmt.Errorf("pod %q: container %q requests privileged mode, which is not allowed on this slave", pod.Name, c.Name)
+		}
+	}
+	for i := range pod.Spec.Volumes {
+		v := &pod.Spec.Volumes[i]
+		if v.Source == nil || v.Source.HostDir == nil {
+			continue
+		}
+		path := filepath.Clean(v.Source.HostDir.Path)
+		if !filepath.IsAbs(path) {
+			return fmt.Errorf("pod %q: volume %q: host path %q is not absolute", pod.Name, v.Name, v.Source.HostDir.Path)
+		}
+		if !k.hostPathAllowed(path) {
+			return fmt.Errorf("pod %q: volume %q: host path %q is not allowed on this slave", pod.Name, v.Name, path)
+		}
+		v.Source.HostDir.Path = path
+	}
+	return nil
+}
+
+// Returns true if the cleaned, absolute path is equal to or below one of the
+// allowed host paths. An empty allowlist allows every path.
+func (k *KubernetesExecutor) hostPathAllowed(path string) bool {
+	if len(k.allowedHostPaths) == 0 {
+		return true
+	}
+	for _, allowed := range k.allowedHostPaths {
+		allowed = filepath.Clean(allowed)
+		if path == allowed || strings.HasPrefix(path, strings.TrimSuffix(allowed, "/")+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// Checks that every host port requested by the pod was granted to the task.
+func validateHostPorts(pod *api.BoundPod, resources []*mesos.Resource) error {
+	var ranges []*mesos.Value_Range
+	for _, r := range resources {
+		if r.GetName() == "ports" && r.GetType() == mesos.Value_RANGES {
+			ranges = append(ranges, r.GetRanges().GetRange()...)
+		}
+	}
+	for _, c := range pod.Spec.Containers {
+		for _, port := range c.Ports {
+			if port.HostPort == 0 {
+				continue
+			}
+			hp := uint64(port.HostPort)
+			granted := false
+			for _, r := range ranges {
+				if r.GetBegin() <= hp && hp <= r.GetEnd() {
+					granted = true
+					break
+				}
+			}
+			if !granted {
+				return fmt.Errorf("pod %q: container %q: host port %d was not granted to the task", pod.Name, c.Name, port.HostPort)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,129 @@
+package executor
+
+import (
+	"fmt"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/mesos/mesos-go/mesos"
+	"github.com/stretchr/testify/assert"
+)
+
+func portsTask(begin, end uint64) *mesos.TaskInfo {
+	return &mesos.TaskInfo{
+		TaskId: &mesos.TaskID{Value: proto.String("t1")},
+		Resources: []*mesos.Resource{{
+			Name: proto.String("ports"),
+			Type: mesos.Value_RANGES.Enum(),
+			Ranges: &mesos.Value_Ranges{Range: []*mesos.Value_Range{
+				{Begin: proto.Uint64(begin), End: proto.Uint64(end)},
+			}},
+		}},
+	}
+}
+
+func hostDirPod(paths ...string) *api.BoundPod {
+	pod := &api.BoundPod{ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: "default"}}
+	for i, path := range paths {
+		pod.Spec.Volumes = append(pod.Spec.Volumes, api.Volume{
+			Name:   fmt.Sprintf("vol%d", i),
+			Source: &api.VolumeSource{HostDir: &api.HostDir{Path: path}},
+		})
+	}
+	return pod
+}
+
+func TestCheckPodPolicy_HostPaths(t *testing.T) {
+	k := &KubernetesExecutor{allowedHostPaths: []string{"/var/lib/data", "/tmp/"}}
+	table := []struct {
+		path    string
+		allowed bool
+		cleaned string
+	}{
+		{"/var/lib/data", true, "/var/lib/data"},
+		{"/var/lib/data/sub/", true, "/var/lib/data/sub"},
+		{"/tmp", true, "/tmp"},
+		{"/var/lib/database", false, ""},
+		{"/var/lib/data/../../../etc", false, ""},
+		{"/etc", false, ""},
+		{"relative/path", false, ""},
+	}
+	for _, tt := range table {
+		pod := hostDirPod(tt.path)
+		err := k.checkPodPolicy(pod, portsTask(0, 0))
+		if tt.allowed {
+			assert.NoError(t, err, tt.path)
+			assert.Equal(t, tt.cleaned, pod.Spec.Volumes[0].Source.HostDir.Path)
+		} else {
+			assert.Error(t, err, tt.path)
+		}
+	}
+
+	// without an allowlist any absolute host path is fine
+	k.allowedHostPaths = nil
+	assert.NoError(t, k.checkPodPolicy(hostDirPod("/etc", "/var/run/docker.sock"), portsTask(0, 0)))
+	assert.Error(t, k.checkPodPolicy(hostDirPod("relative"), portsTask(0, 0)))
+
+	// other volume sources aren't restricted
+	pod := hostDirPod()
+	pod.Spec.Volumes = []api.Volume{{Name: "scratch", Source: &api.VolumeSource{EmptyDir: &api.EmptyDir{}}}}
+	k.allowedHostPaths = []string{"/data"}
+	assert.NoError(t, k.checkPodPolicy(pod, portsTask(0, 0)))
+}
+
+func TestCheckPodPolicy_Privileged(t *testing.T) {
+	pod := &api.BoundPod{
+		ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: "default"},
+		Spec: api.PodSpec{Containers: []api.Container{
+			{Name: "web"},
+			{Name: "admin", Privileged: true},
+		}},
+	}
+	k := &KubernetesExecutor{}
+	err := k.checkPodPolicy(pod, portsTask(0, 0))
+	if assert.Error(t, err) {
+		assert.Contains(t, err.Error(), `container "admin" requests privileged mode`)
+	}
+
+	k.allowPrivileged = true
+	assert.NoError(t, k.checkPodPolicy(pod, portsTask(0, 0)))
+}
+
+func TestCheckPodPolicy_HostPorts(t *testing.T) {
+	pod := func(hostPorts ...int) *api.BoundPod {
+		c := api.Container{Name: "web"}
+		for _, hp := range hostPorts {
+			c.Ports = append(c.Ports, api.Port{ContainerPort: 80, HostPort: hp})
+		}
+		return &api.BoundPod{
+			ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: "default"},
+			Spec:       api.PodSpec{Containers: []api.Container{c}},
+		}
+	}
+	k := &KubernetesExecutor{}
+	table := []struct {
+		hostPorts []int
+		granted   bool
+	}{
+		{nil, true},
+		{[]int{0}, true}, // no host port requested
+		{[]int{31000}, true},
+		{[]int{31000, 31010}, true},
+		{[]int{30999}, false},
+		{[]int{31000, 31011}, false},
+	}
+	for _, tt := range table {
+		err := k.checkPodPolicy(pod(tt.hostPorts...), portsTask(31000, 31010))
+		if tt.granted {
+			assert.NoError(t, err, "%v", tt.hostPorts)
+		} else {
+			assert.Error(t, err, "%v", tt.hostPorts)
+		}
+	}
+
+	// a task without a ports resource grants no host ports
+	noPorts := &mesos.TaskInfo{TaskId: &mesos.TaskID{Value: proto.String("t1")}}
+	assert.NoError(t, k.checkPodPolicy(pod(), noPorts))
+	assert.Error(t, k.checkPodPolicy(pod(8080), noPorts))
+}
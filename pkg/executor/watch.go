@@ -0,0 +1,114 @@
+package executor
+
+import (
+	"reflect"
+	"sync"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/watch"
+	log "github.com/golang/glog"
+)
+
+// number of events buffered per watcher; watchers that fall further behind are
+// stopped and must reconnect.
+const podWatchQueueLength = 100
+
+// podBroadcaster turns the snapshots of bound pods that the executor sends to the
+// kubelet into ADDED, MODIFIED and DELETED events for any number of watchers.
+type podBroadcaster struct {
+	lock     sync.Mutex
+	pods     map[string]api.BoundPod // last snapshot, by pod full name
+	watchers map[*podWatcher]struct{}
+}
+
+func newPodBroadcaster() *podBroadcaster {
+	return &podBroadcaster{
+		pods:     map[string]api.BoundPod{},
+		watchers: map[*podWatcher]struct{}{},
+	}
+}
+
+// watch returns a watcher that first receives an ADDED event for each pod of the
+// current snapshot.
+func (b *podBroadcaster) watch() watch.Interface {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	queueLength := podWatchQueueLength
+	if len(b.pods) > queueLength {
+		queueLength = len(b.pods)
+	}
+	w := &podWatcher{
+		broadcaster: b,
+		result:      make(chan watch.Event, queueLength),
+	}
+	for name := range b.pods {
+		pod := b.pods[name]
+		w.result <- watch.Event{Type: watch.Added, Object: &pod}
+	}
+	b.watchers[w] = struct{}{}
+	return w
+}
+
+// update compares a new snapshot of bound pods with the previous one and
+// broadcasts the differences.
+func (b *podBroadcaster) update(pods map[string]*api.BoundPod) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	for name, p := range pods {
+		pod := *p
+		if old, found := b.pods[name]; !found {
+			b.broadcast(watch.Event{Type: watch.Added, Object: &pod})
+		} else if !reflect.DeepEqual(old, pod) {
+			b.broadcast(watch.Event{Type: watch.Modified, Object: &pod})
+		}
+	}
+	for name := range b.pods {
+		if _, found := pods[name]; !found {
+			pod := b.pods[name]
+			b.broadcast(watch.Event{Type: watch.Deleted, Object: &pod})
+		}
+	}
+	b.pods = make(map[string]api.BoundPod, len(pods))
+	for name, p := range pods {
+		b.pods[name] = *p
+	}
+}
+
+// broadcast sends the event to all watchers without blocking. Assumes that the
+// caller is locking around pod broadcaster state.
+func (b *podBroadcaster) broadcast(event watch.Event) {
+	for w := range b.watchers {
+		select {
+		case w.result <- event:
+		default:
+			log.Warningf("Bound pod watcher fell behind, stopping it")
+			b.remove(w)
+		}
+	}
+}
+
+// Assumes that the caller is locking around pod broadcaster state.
+func (b *podBroadcaster) remove(w *podWatcher) {
+	if _, found := b.watchers[w]; found {
+		delete(b.watchers, w)
+		close(w.result)
+	}
+}
+
+// podWatcher implements watch.Interface for a single client of the broadcaster.
+type podWatcher struct {
+	broadcaster *podBroadcaster
+	result      chan watch.Event
+}
+
+func (w *podWatcher) ResultChan() <-chan watch.Event {
+	return w.result
+}
+
+func (w *podWatcher) Stop() {
+	w.broadcaster.lock.Lock()
+	defer w.broadcaster.lock.Unlock()
+	w.broadcaster.remove(w)
+}
@@ -0,0 +1,124 @@
+package executor
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/watch"
+	"github.com/stretchr/testify/assert"
+)
+
+func boundPod(name, image string) *api.BoundPod {
+	return &api.BoundPod{
+		ObjectMeta: api.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       api.PodSpec{Containers: []api.Container{{Name: "web", Image: image}}},
+	}
+}
+
+// returns the events that are queued for the watcher, by pod name
+func queuedEvents(w watch.Interface) map[string]watch.EventType {
+	events := map[string]watch.EventType{}
+	for {
+		select {
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				return events
+			}
+			events[event.Object.(*api.BoundPod).Name] = event.Type
+		default:
+			return events
+		}
+	}
+}
+
+func TestPodBroadcaster_InitialSnapshot(t *testing.T) {
+	b := newPodBroadcaster()
+	b.update(map[string]*api.BoundPod{
+		"foo": boundPod("foo", "nginx"),
+		"bar": boundPod("bar", "redis"),
+	})
+
+	w := b.watch()
+	defer w.Stop()
+	assert.Equal(t, map[string]watch.EventType{"foo": watch.Added, "bar": watch.Added}, queuedEvents(w))
+}
+
+func TestPodBroadcaster_Diff(t *testing.T) {
+	assert := assert.New(t)
+	b := newPodBroadcaster()
+	b.update(map[string]*api.BoundPod{
+		"foo": boundPod("foo", "nginx"),
+		"bar": boundPod("bar", "redis"),
+	})
+	w := b.watch()
+	defer w.Stop()
+	queuedEvents(w)
+
+	b.update(map[string]*api.BoundPod{
+		"foo": boundPod("foo", "nginx"),
+		"bar": boundPod("bar", "redis:2.8"),
+		"baz": boundPod("baz", "busybox"),
+	})
+	assert.Equal(map[string]watch.EventType{"bar": watch.Modified, "baz": watch.Added}, queuedEvents(w))
+
+	b.update(map[string]*api.BoundPod{"baz": boundPod("baz", "busybox")})
+	assert.Equal(map[string]watch.EventType{"foo": watch.Deleted, "bar": watch.Deleted}, queuedEvents(w))
+
+	// an unchanged snapshot yields no events
+	b.update(map[string]*api.BoundPod{"baz": boundPod("baz", "busybox")})
+	assert.Empty(queuedEvents(w))
+}
+
+func TestPodBroadcaster_SnapshotIsCopied(t *testing.T) {
+	b := newPodBroadcaster()
+	pod := boundPod("foo", "nginx")
+	b.update(map[string]*api.BoundPod{"foo": pod})
+	w := b.watch()
+	defer w.Stop()
+	queuedEvents(w)
+
+	// changes to the executor's pod are only seen with the next snapshot
+	pod.Labels = map[string]string{"name": "foo"}
+	b.update(map[string]*api.BoundPod{"foo": pod})
+	assert.Equal(t, map[string]watch.EventType{"foo": watch.Modified}, queuedEvents(w))
+}
+
+func TestPodBroadcaster_StopsWatchersThatFallBehind(t *testing.T) {
+	assert := assert.New(t)
+	b := newPodBroadcaster()
+	slow := b.watch()
+	fast := b.watch()
+	defer fast.Stop()
+
+	pods := map[string]*api.BoundPod{}
+	for i := 0; i <= podWatchQueueLength; i++ {
+		name := fmt.Sprintf("pod%d", i)
+		pods[name] = boundPod(name, "nginx")
+		b.update(pods)
+		queuedEvents(fast)
+	}
+
+	received := 0
+	for range slow.ResultChan() {
+		received++
+	}
+	assert.Equal(podWatchQueueLength, received, "the result channel is closed once the queue overflows")
+	assert.Len(b.watchers, 1)
+
+	// stopping a watcher that was dropped already is fine
+	slow.Stop()
+}
+
+func TestPodBroadcaster_Stop(t *testing.T) {
+	b := newPodBroadcaster()
+	w := b.watch()
+	w.Stop()
+	_, ok := <-w.ResultChan()
+	assert.False(t, ok)
+	assert.Empty(t, b.watchers)
+
+	// stopped watchers don't receive events
+	b.update(map[string]*api.BoundPod{"foo": boundPod("foo", "nginx")})
+	w.Stop()
+}
@@ -0,0 +1,171 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/labels"
+	log "github.com/golang/glog"
+	"github.com/mesos/mesos-go/mesos"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
+)
+
+// Drain instructs the executor running on the slave with the given host name to
+// terminate its pods and stop accepting new ones. Pods terminated by the drain are
+// rescheduled elsewhere: the slave's offers are declined until it is undrained.
+func (k *KubernetesScheduler) Drain(hostName string) error {
+	return k.setDraining(hostName, true)
+}
+
+// Undrain cancels the drain of the slave with the given host name, whose executor
+// accepts new pods again. Pods that were already terminated stay where they were
+// rescheduled.
+func (k *KubernetesScheduler) Undrain(hostName string) error {
+	return k.setDraining(hostName, false)
+}
+
+func (k *KubernetesScheduler) setDraining(hostName string, draining bool) error {
+	k.Lock()
+	defer k.Unlock()
+
+	slaveId, found := k.slaveIDs[hostName]
+	if !found {
+		return fmt.Errorf("unknown slave host %q", hostName)
+	}
+	slave, found := k.slaves[slaveId]
+	if !found {
+		return fmt.Errorf("unknown slave %v", slaveId)
+	}
+	kind := messages.DrainKind
+	if !draining {
+		kind = messages.UndrainKind
+	}
+	msg, err := messages.EncodeFrameworkMessage(kind, nil)
+	if err != nil {
+		return err
+	}
+	if draining {
+		log.Infof("Draining executor on slave %v (%v)", hostName, slaveId)
+	} else {
+		log.Infof("Undraining executor on slave %v (%v)", hostName, slaveId)
+	}
+	k.markDraining(slave, draining)
+	return k.driver.SendFrameworkMessage(k.executor.ExecutorId, &mesos.SlaveID{Value: &slaveId}, msg)
+}
+
+// executorDraining records the drain mode reported by the executor of a slave,
+// which may have been drained over its own HTTP endpoints rather than by the
+// scheduler. Assumes that the caller is locking around scheduler state.
+func (k *KubernetesScheduler) executorDraining(slaveId string, draining bool) {
+	slave, found := k.slaves[slaveId]
+	if !found {
+		log.Warningf("Ignoring drain mode of executor on unknown slave %v", slaveId)
+		return
+	}
+	if slave.draining != draining {
+		log.Infof("Executor on slave %v reports draining=%v", slaveId, draining)
+		k.markDraining(slave, draining)
+	}
+}
+
+// Declines the outstanding offers of a slave that is being drained, as well as
+// its future offers. Assumes that the caller is locking around scheduler state.
+func (k *KubernetesScheduler) markDraining(slave *Slave, draining bool) {
+	if draining {
+		for offerId := range slave.Offers {
+			k.deleteOffer(offerId)
+		}
+	}
+	slave.draining = draining
+}
+
+// DrainHandler returns an http.Handler that drains the slave named by the "host"
+// query parameter of a POST request.
+func (k *KubernetesScheduler) DrainHandler() http.Handler {
+	return k.drainHandler("Drain", k.Drain)
+}
+
+// UndrainHandler returns an http.Handler that undrains the slave named by the "host"
+// query parameter of a POST request.
+func (k *KubernetesScheduler) UndrainHandler() http.Handler {
+	return k.drainHandler("Undrain", k.Undrain)
+}
+
+func (k *KubernetesScheduler) drainHandler(op string, f func(hostName string) error) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.Method != "POST" {
+			http.Error(w, op+" requires a POST request", http.StatusMethodNotAllowed)
+			return
+		}
+		host := req.URL.Query().Get("host")
+		if host == "" {
+			http.Error(w, "Missing 'host=' query entry.", http.StatusBadRequest)
+			return
+		}
+		if err := f(host); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusAccepted)
+	})
+}
+
+// reschedulePod recreates a pod whose task was terminated by a drained executor.
+// Bound pods cannot be unbound, so the pod is deleted and created again without a
+// host, at which point it is picked up for scheduling like any other new pod. Pods
+// selected by a replication controller are only deleted: the controller creates
+// their replacement, and recreating them as well would yield duplicates.
+func (k *KubernetesScheduler) reschedulePod(namespace, name string) {
+	pods := k.client.Pods(namespace)
+	pod, err := pods.Get(name)
+	if err != nil {
+		log.Errorf("Failed to reschedule drained pod %v/%v: %v", namespace, name, err)
+		return
+	}
+	managed, err := k.replicatedPod(pod)
+	if err != nil {
+		log.Errorf("Failed to reschedule drained pod %v/%v: %v", namespace, name, err)
+		return
+	}
+	replacement := &api.Pod{
+		ObjectMeta: api.ObjectMeta{
+			Name:        pod.Name,
+			Namespace:   pod.Namespace,
+			Labels:      pod.Labels,
+			Annotations: pod.Annotations,
+		},
+		Spec: pod.Spec,
+	}
+	if err := pods.Delete(name); err != nil {
+		log.Errorf("Failed to delete drained pod %v/%v: %v", namespace, name, err)
+		return
+	}
+	if managed {
+		log.Infof("Deleted drained pod %v/%v, its replication controller replaces it", namespace, name)
+		return
+	}
+	if _, err := pods.Create(replacement); err != nil {
+		log.Errorf("Failed to recreate drained pod %v/%v: %v", namespace, name, err)
+		return
+	}
+	log.Infof("Recreated drained pod %v/%v for rescheduling", namespace, name)
+}
+
+// returns true if a replication controller selects the given pod
+func (k *KubernetesScheduler) replicatedPod(pod *api.Pod) (bool, error) {
+	controllers, err := k.client.ReplicationControllers(pod.Namespace).List(labels.Everything())
+	if err != nil {
+		return false, err
+	}
+	return selectedByController(pod, controllers.Items), nil
+}
+
+func selectedByController(pod *api.Pod, controllers []api.ReplicationController) bool {
+	for _, rc := range controllers {
+		if len(rc.Spec.Selector) > 0 && labels.Set(rc.Spec.Selector).AsSelector().Matches(labels.Set(pod.Labels)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/mesos/mesos-go/mesos"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+)
+
+func newOffer(offerId, slaveId, hostName string) *mesos.Offer {
+	return &mesos.Offer{
+		Id:          &mesos.OfferID{Value: proto.String(offerId)},
+		FrameworkId: &mesos.FrameworkID{Value: proto.String("framework")},
+		SlaveId:     &mesos.SlaveID{Value: proto.String(slaveId)},
+		Hostname:    proto.String(hostName),
+	}
+}
+
+func TestDrain_DeclinesOffersUntilUndrained(t *testing.T) {
+	assert := assert.New(t)
+	driver := &MockSchedulerDriver{}
+	k := New(&mesos.ExecutorInfo{ExecutorId: &mesos.ExecutorID{Value: proto.String("executor")}}, nil, nil)
+	k.driver = driver
+
+	drain, _ := messages.EncodeFrameworkMessage(messages.DrainKind, nil)
+	undrain, _ := messages.EncodeFrameworkMessage(messages.UndrainKind, nil)
+	driver.On("SendFrameworkMessage", mock.Anything, mock.Anything, drain).Return(nil).Once()
+	driver.On("SendFrameworkMessage", mock.Anything, mock.Anything, undrain).Return(nil).Once()
+	driver.On("DeclineOffer", mock.Anything, mock.Anything).Return(nil).Twice()
+
+	k.ResourceOffers(driver, []*mesos.Offer{newOffer("o1", "s1", "host1")})
+	assert.Error(k.Drain("host2"))
+
+	// the outstanding offer of the slave is declined, and so are its new offers
+	assert.NoError(k.Drain("host1"))
+	assert.True(k.slaves["s1"].draining)
+	assert.Empty(k.slaves["s1"].Offers)
+	k.ResourceOffers(driver, []*mesos.Offer{newOffer("o2", "s1", "host1"), newOffer("o3", "s2", "host2")})
+	assert.Empty(k.slaves["s1"].Offers)
+	assert.Equal(map[string]empty{"o3": {}}, k.slaves["s2"].Offers)
+
+	assert.NoError(k.Undrain("host1"))
+	assert.False(k.slaves["s1"].draining)
+	k.ResourceOffers(driver, []*mesos.Offer{newOffer("o4", "s1", "host1")})
+	assert.Equal(map[string]empty{"o4": {}}, k.slaves["s1"].Offers)
+
+	driver.AssertExpectations(t)
+}
+
+func TestDrain_ReportedByExecutor(t *testing.T) {
+	assert := assert.New(t)
+	driver := &MockSchedulerDriver{}
+	k := New(&mesos.ExecutorInfo{ExecutorId: &mesos.ExecutorID{Value: proto.String("executor")}}, nil, nil)
+	k.driver = driver
+	driver.On("DeclineOffer", mock.Anything, mock.Anything).Return(nil).Twice()
+
+	k.ResourceOffers(driver, []*mesos.Offer{newOffer("o1", "s1", "host1")})
+
+	// the executor was drained over HTTP, the scheduler doesn't message it back
+	drain, _ := messages.EncodeFrameworkMessage(messages.DrainKind, nil)
+	k.FrameworkMessage(driver, nil, &mesos.SlaveID{Value: proto.String("s1")}, drain)
+	assert.True(k.slaves["s1"].draining)
+	assert.Empty(k.slaves["s1"].Offers)
+	k.ResourceOffers(driver, []*mesos.Offer{newOffer("o2", "s1", "host1")})
+	assert.Empty(k.slaves["s1"].Offers)
+
+	undrain, _ := messages.EncodeFrameworkMessage(messages.UndrainKind, nil)
+	k.FrameworkMessage(driver, nil, &mesos.SlaveID{Value: proto.String("s1")}, undrain)
+	assert.False(k.slaves["s1"].draining)
+	k.ResourceOffers(driver, []*mesos.Offer{newOffer("o3", "s1", "host1")})
+	assert.Equal(map[string]empty{"o3": {}}, k.slaves["s1"].Offers)
+
+	// unknown slaves are ignored
+	k.FrameworkMessage(driver, nil, &mesos.SlaveID{Value: proto.String("s2")}, drain)
+	assert.Nil(k.slaves["s2"])
+
+	driver.AssertExpectations(t)
+}
+
+func TestSelectedByController(t *testing.T) {
+	assert := assert.New(t)
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{Labels: map[string]string{"app": "web", "tier": "frontend"}}}
+	controller := func(selector map[string]string) api.ReplicationController {
+		return api.ReplicationController{Spec: api.ReplicationControllerSpec{Selector: selector}}
+	}
+
+	assert.False(selectedByController(pod, nil))
+	assert.False(selectedByController(pod, []api.ReplicationController{
+		controller(map[string]string{}),
+		controller(map[string]string{"app": "db"}),
+		controller(map[string]string{"app": "web", "tier": "backend"}),
+	}))
+	assert.True(selectedByController(pod, []api.ReplicationController{
+		controller(map[string]string{"app": "db"}),
+		controller(map[string]string{"app": "web"}),
+	}))
+}
@@ -18,8 +18,8 @@ import (
 	plugin "github.com/GoogleCloudPlatform/kubernetes/plugin/pkg/scheduler"
 	log "github.com/golang/glog"
 	"github.com/mesos/mesos-go/mesos"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
 	"github.com/mesosphere/kubernetes-mesos/pkg/queue"
-	"gopkg.in/v2/yaml"
 )
 
 const (
@@ -197,7 +197,11 @@ func (b *binder) prepareTaskForLaunch(ctx api.Context, machine string, task *Pod
 	// pod containers will use for service discovery. the kubelet-executor uses this
 	// boundPod to instantiate the pods and this is the last update we make before
 	// firing up the pod.
-	task.TaskInfo.Data, err = yaml.Marshal(&boundPod)
+	apiVersion, encoding := messages.DefaultApiVersion, messages.EncodingLegacyYAML
+	if slave, ok := b.api.slaveFor(task.TaskInfo.GetSlaveId().GetValue()); ok {
+		apiVersion, encoding = slave.payloadFormat()
+	}
+	task.TaskInfo.Data, err = messages.EncodeBoundPod(boundPod, apiVersion, encoding)
 	if err != nil {
 		log.V(2).Infof("Failed to marshal the updated boundPod")
 		return err
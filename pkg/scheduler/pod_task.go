@@ -7,11 +7,13 @@ import (
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
 	log "github.com/golang/glog"
 	"github.com/mesos/mesos-go/mesos"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
 )
 
 const (
 	containerCpus = 0.25 // initial CPU allocated for executor
-	containerMem  = 64   // initial MB of memory allocated for executor
+	containerMem  = 64   // MB of memory allocated to each container without a memory limit
+	bytesPerMB    = 1024 * 1024
 )
 
 // A struct that describes a pod task.
@@ -23,6 +25,7 @@ type PodTask struct {
 	launched bool
 	deleted  bool
 	podKey   string
+	Usage    *messages.ResourceUsage // most recently reported by the executor, may be nil
 }
 
 func (t *PodTask) hasAcceptedOffer() bool {
@@ -54,9 +57,10 @@ func (t *PodTask) FillTaskInfo(offer PerishableOffer) error {
 
 	t.TaskInfo.TaskId = newTaskID(t.ID)
 	t.TaskInfo.SlaveId = details.GetSlaveId()
+	cpus, mem := t.Resources()
 	t.TaskInfo.Resources = []*mesos.Resource{
-		mesos.ScalarResource("cpus", containerCpus),
-		mesos.ScalarResource("mem", containerMem),
+		mesos.ScalarResource("cpus", cpus),
+		mesos.ScalarResource("mem", mem),
 	}
 	if ports := rangeResource("ports", t.Ports()); ports != nil {
 		t.TaskInfo.Resources = append(t.TaskInfo.Resources, ports)
@@ -75,6 +79,35 @@ func (t *PodTask) ClearTaskInfo() {
 	t.TaskInfo.Data = nil
 }
 
+// Resources returns the cpus and MB of memory required by the pod: the sum of the
+// limits declared by its containers, plus the default allocations for containers
+// that don't declare limits. The default cpus are shared by all such containers,
+// while each of them gets the default memory since the executor enforces memory
+// as a hard limit. The executor splits what's left of the grant evenly across the
+// containers without limits.
+func (t *PodTask) Resources() (cpus, mem float64) {
+	cpuUnlimited := false
+	for _, container := range t.Pod.Spec.Containers {
+		if container.CPU > 0 {
+			cpus += float64(container.CPU) / 1000
+		} else {
+			cpuUnlimited = true
+		}
+		if container.Memory > 0 {
+			mem += float64(container.Memory) / bytesPerMB
+		} else {
+			mem += containerMem
+		}
+	}
+	if cpuUnlimited || cpus == 0 {
+		cpus += containerCpus
+	}
+	if mem == 0 {
+		mem = containerMem
+	}
+	return
+}
+
 func (t *PodTask) Ports() []uint64 {
 	ports := make([]uint64, 0)
 	for _, container := range t.Pod.Spec.Containers {
@@ -133,7 +166,7 @@ func (t *PodTask) AcceptOffer(offer *mesos.Offer) bool {
 		return false
 	}
 
-	if (cpus < containerCpus) || (mem < containerMem) {
+	if requiredCpus, requiredMem := t.Resources(); (cpus < requiredCpus) || (mem < requiredMem) {
 		log.V(2).Infof("Not enough resources: cpus: %f mem: %f", cpus, mem)
 		return false
 	}
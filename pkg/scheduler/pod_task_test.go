@@ -0,0 +1,37 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPodTaskResources(t *testing.T) {
+	assert := assert.New(t)
+	task := &PodTask{ID: "bar", Pod: &api.Pod{}}
+
+	// no containers
+	cpus, mem := task.Resources()
+	assert.Equal(containerCpus, cpus)
+	assert.Equal(float64(containerMem), mem)
+
+	// only containers without limits, each of which gets the default memory
+	task.Pod.Spec.Containers = []api.Container{{Name: "a"}, {Name: "b"}}
+	cpus, mem = task.Resources()
+	assert.Equal(containerCpus, cpus)
+	assert.Equal(float64(2*containerMem), mem)
+
+	// a mix of limited and unlimited containers
+	task.Pod.Spec.Containers[0].CPU = 500
+	task.Pod.Spec.Containers[0].Memory = 128 * bytesPerMB
+	cpus, mem = task.Resources()
+	assert.Equal(0.5+containerCpus, cpus)
+	assert.Equal(float64(128+containerMem), mem)
+
+	// only limited containers
+	task.Pod.Spec.Containers = task.Pod.Spec.Containers[:1]
+	cpus, mem = task.Resources()
+	assert.Equal(0.5, cpus)
+	assert.Equal(float64(128), mem)
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/GoogleCloudPlatform/kubernetes/pkg/client"
 	log "github.com/golang/glog"
 	"github.com/mesos/mesos-go/mesos"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
 )
 
 const (
@@ -24,6 +25,43 @@ const (
 type Slave struct {
 	HostName string
 	Offers   map[string]empty
+
+	// advertised by the executor running on the slave, nil until then
+	capabilities *messages.ExecutorCapabilities
+
+	// when true the slave's offers are declined, see Drain
+	draining bool
+}
+
+// returns the api version and encoding to use for task payloads sent to the
+// executor on this slave: the newest api version and the most compact encoding
+// supported by both ends. Until the executor has advertised its capabilities it
+// may predate the TaskPayload envelope, so the legacy yaml encoding is used.
+func (s *Slave) payloadFormat() (apiVersion, encoding string) {
+	if s.capabilities == nil {
+		return messages.DefaultApiVersion, messages.EncodingLegacyYAML
+	}
+	apiVersion, encoding = messages.DefaultApiVersion, messages.EncodingJSON
+	local := messages.LocalCapabilities()
+	for i := len(local.ApiVersions) - 1; i >= 0; i-- {
+		if containsString(s.capabilities.ApiVersions, local.ApiVersions[i]) {
+			apiVersion = local.ApiVersions[i]
+			break
+		}
+	}
+	if containsString(s.capabilities.Encodings, messages.EncodingProtobuf) {
+		encoding = messages.EncodingProtobuf
+	}
+	return
+}
+
+func containsString(list []string, s string) bool {
+	for _, x := range list {
+		if x == s {
+			return true
+		}
+	}
+	return false
 }
 
 func newSlave(hostName string) *Slave {
@@ -98,6 +136,15 @@ func New(executor *mesos.ExecutorInfo, scheduleFunc PodScheduleFunc, client *cli
 	return k
 }
 
+// remove the pod => task mapping, but only if it still refers to the given task:
+// another task may have been created for the same pod in the meantime.
+// assume that the caller has already locked around access to task state
+func (k *KubernetesScheduler) unmapPodTask(task *PodTask) {
+	if taskId, found := k.podToTask[task.podKey]; found && taskId == task.ID {
+		delete(k.podToTask, task.podKey)
+	}
+}
+
 // assume that the caller has already locked around access to task state
 func (k *KubernetesScheduler) getTask(taskId string) (*PodTask, stateType) {
 	if task, found := k.runningTasks[taskId]; found {
@@ -153,7 +200,8 @@ func (k *KubernetesScheduler) ResourceOffers(driver mesos.SchedulerDriver, offer
 	defer k.Unlock()
 
 	// Record the offers in the global offer map as well as each slave's offer map.
-	k.offers.Add(offers)
+	// Offers of draining slaves are declined right away.
+	accepted := make([]*mesos.Offer, 0, len(offers))
 	for _, offer := range offers {
 		offerId := offer.GetId().GetValue()
 		slaveId := offer.GetSlaveId().GetValue()
@@ -163,9 +211,18 @@ func (k *KubernetesScheduler) ResourceOffers(driver mesos.SchedulerDriver, offer
 			k.slaves[slaveId] = newSlave(offer.GetHostname())
 			slave = k.slaves[slaveId]
 		}
-		slave.Offers[offerId] = empty{}
 		k.slaveIDs[slave.HostName] = slaveId
+		if slave.draining {
+			log.V(2).Infof("Declining offer %v of draining slave %v", offerId, slave.HostName)
+			if err := driver.DeclineOffer(offer.GetId(), nil); err != nil {
+				log.Warningf("Failed to decline offer %v: %v", offerId, err)
+			}
+			continue
+		}
+		slave.Offers[offerId] = empty{}
+		accepted = append(accepted, offer)
 	}
+	k.offers.Add(accepted)
 }
 
 // requires the caller to have locked the offers and slaves state
@@ -240,7 +297,9 @@ func (k *KubernetesScheduler) handleTaskRunning(taskStatus *mesos.TaskStatus) {
 		k.runningTasks[taskId] = task
 		delete(k.pendingTasks, taskId)
 	case stateRunning:
-		log.Warningf("Ignore status TASK_RUNNING because the the task is already running")
+		// the executor sends updated pod status whenever container state changes
+		log.V(2).Infof("Received updated running status for task: '%v'", taskId)
+		k.fillRunningPodInfo(task, taskStatus)
 	case stateFinished:
 		log.Warningf("Ignore status TASK_RUNNING because the the task is already finished")
 	default:
@@ -250,29 +309,24 @@ func (k *KubernetesScheduler) handleTaskRunning(taskStatus *mesos.TaskStatus) {
 
 func (k *KubernetesScheduler) fillRunningPodInfo(task *PodTask, taskStatus *mesos.TaskStatus) {
 	task.Pod.Status.Phase = api.PodRunning
-	if taskStatus.Data != nil {
-		var info api.PodInfo
-		err := json.Unmarshal(taskStatus.Data, &info)
-		if err == nil {
-			task.Pod.Status.Info = info
-			/// TODO(jdef) this is problematic using default Docker networking on a default
-			/// Docker bridge -- meaning that pod IP's are not routable across the
-			/// k8s-mesos cluster. For now, I've duplicated logic from k8s fillPodInfo
-			netContainerInfo, ok := info["net"] // docker.Container
-			if ok {
-				if netContainerInfo.PodIP != "" {
-					task.Pod.Status.PodIP = netContainerInfo.PodIP
-				} else {
-					log.Warningf("No network settings: %#v", netContainerInfo)
-				}
-			} else {
-				log.Warningf("Couldn't find network container for %s in %v", task.podKey, info)
-			}
-		} else {
-			log.Errorf("Invalid TaskStatus.Data for task '%v': %v", task.ID, err)
-		}
-	} else {
+	if taskStatus.Data == nil {
 		log.Errorf("Missing TaskStatus.Data for task '%v'", task.ID)
+		return
+	}
+	status, err := messages.DecodePodStatus(taskStatus.Data)
+	if err != nil {
+		log.Errorf("Invalid TaskStatus.Data for task '%v': %v", task.ID, err)
+		return
+	}
+	task.Pod.Status.Info = status.Info()
+	task.Pod.Status.HostIP = status.HostIP
+	/// TODO(jdef) this is problematic using default Docker networking on a default
+	/// Docker bridge -- meaning that pod IP's are not routable across the
+	/// k8s-mesos cluster.
+	if status.PodIP != "" {
+		task.Pod.Status.PodIP = status.PodIP
+	} else {
+		log.Warningf("No pod IP reported for %s", task.podKey)
 	}
 }
 
@@ -289,7 +343,7 @@ func (k *KubernetesScheduler) handleTaskFinished(taskStatus *mesos.TaskStatus) {
 		log.V(2).Infof(
 			"Received finished status for running task: '%v', running/pod task queue length = %d/%d",
 			taskStatus, len(k.runningTasks), len(k.podToTask))
-		delete(k.podToTask, task.podKey)
+		k.unmapPodTask(task)
 		k.finishedTasks.Next().Value = taskId
 		delete(k.runningTasks, taskId)
 	case stateFinished:
@@ -309,7 +363,7 @@ func (k *KubernetesScheduler) handleTaskFailed(taskStatus *mesos.TaskStatus) {
 		fallthrough
 	case stateRunning:
 		delete(k.runningTasks, taskId)
-		delete(k.podToTask, task.podKey)
+		k.unmapPodTask(task)
 	}
 }
 
@@ -333,7 +387,10 @@ func (k *KubernetesScheduler) handleTaskKilled(taskStatus *mesos.TaskStatus) {
 		fallthrough
 	case stateRunning:
 		delete(k.runningTasks, taskId)
-		delete(k.podToTask, task.podKey)
+		k.unmapPodTask(task)
+		if !task.deleted && taskStatus.GetMessage() == messages.DrainReason {
+			go k.reschedulePod(task.Pod.Namespace, task.Pod.Name)
+		}
 	}
 }
 
@@ -347,14 +404,52 @@ func (k *KubernetesScheduler) handleTaskLost(taskStatus *mesos.TaskStatus) {
 		fallthrough
 	case stateRunning:
 		delete(k.runningTasks, taskId)
-		delete(k.podToTask, task.podKey)
+		k.unmapPodTask(task)
 	}
 }
 
 // FrameworkMessage is called when the scheduler receives a message from the executor.
 func (k *KubernetesScheduler) FrameworkMessage(driver mesos.SchedulerDriver,
 	executorId *mesos.ExecutorID, slaveId *mesos.SlaveID, message string) {
-	log.Infof("Received messages from executor %v of slave %v, %v\n", executorId, slaveId, message)
+	log.V(2).Infof("Received messages from executor %v of slave %v, %v\n", executorId, slaveId, message)
+
+	kind, payload, err := messages.DecodeFrameworkMessage(message)
+	if err != nil {
+		log.Warningf("Ignoring unrecognized message from executor %v of slave %v: %v", executorId, slaveId, err)
+		return
+	}
+	switch kind {
+	case messages.UsageReportKind:
+		report := &messages.UsageReport{}
+		if err := json.Unmarshal(payload, report); err != nil {
+			log.Warningf("Invalid usage report from executor %v of slave %v: %v", executorId, slaveId, err)
+			return
+		}
+		k.Lock()
+		defer k.Unlock()
+		k.handleUsageReport(report)
+	case messages.CapabilitiesKind:
+		caps := &messages.ExecutorCapabilities{}
+		if err := json.Unmarshal(payload, caps); err != nil {
+			log.Warningf("Invalid capabilities from executor %v of slave %v: %v", executorId, slaveId, err)
+			return
+		}
+		k.Lock()
+		defer k.Unlock()
+		if slave, found := k.slaves[slaveId.GetValue()]; found {
+			log.V(1).Infof("Executor %v of slave %v supports api versions %v, encodings %v",
+				executorId, slaveId, caps.ApiVersions, caps.Encodings)
+			slave.capabilities = caps
+		} else {
+			log.Warningf("Ignoring capabilities from executor %v of unknown slave %v", executorId, slaveId)
+		}
+	case messages.DrainKind, messages.UndrainKind:
+		k.Lock()
+		defer k.Unlock()
+		k.executorDraining(slaveId.GetValue(), kind == messages.DrainKind)
+	default:
+		log.Warningf("Ignoring message of unknown kind %q from executor %v of slave %v", kind, executorId, slaveId)
+	}
 }
 
 // SlaveLost is called when some slave is lost.
@@ -369,6 +464,8 @@ func (k *KubernetesScheduler) SlaveLost(driver mesos.SchedulerDriver, slaveId *m
 		for offerId := range slave.Offers {
 			k.offers.Invalidate(offerId)
 		}
+		// the slave may come back with another version of the executor
+		slave.capabilities = nil
 	}
 
 	// TODO(jdef): delete slave from our internal list?
@@ -382,6 +479,15 @@ func (k *KubernetesScheduler) ExecutorLost(driver mesos.SchedulerDriver,
 	executorId *mesos.ExecutorID, slaveId *mesos.SlaveID, status int) {
 	log.Infof("Executor %v of slave %v is lost, status: %v\n", executorId, slaveId, status)
 	// TODO(yifan): Restart any unfinished tasks of the executor.
+
+	k.Lock()
+	defer k.Unlock()
+
+	// the next executor on the slave may be older, e.g. after a rollback, so stick
+	// to the legacy payload format until it advertises its capabilities
+	if slave, ok := k.slaves[slaveId.GetValue()]; ok {
+		slave.capabilities = nil
+	}
 }
 
 // Error is called when there is some error.
@@ -0,0 +1,131 @@
+package scheduler
+
+import (
+	"container/ring"
+	"encoding/json"
+	"testing"
+
+	"code.google.com/p/goprotobuf/proto"
+	"github.com/GoogleCloudPlatform/kubernetes/pkg/api"
+	"github.com/mesos/mesos-go/mesos"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFillRunningPodInfo(t *testing.T) {
+	assert := assert.New(t)
+	data, err := json.Marshal(&messages.PodStatus{
+		Version: messages.StatusVersion,
+		PodIP:   "10.2.0.3",
+		HostIP:  "10.0.0.1",
+		Containers: map[string]messages.ContainerStatus{
+			"web": {
+				State:        api.ContainerState{Running: &api.ContainerStateRunning{}},
+				RestartCount: 2,
+				Image:        "nginx",
+			},
+		},
+	})
+	assert.Nil(err)
+
+	task := &PodTask{ID: "bar", Pod: &api.Pod{}, podKey: "/pods/default/foo"}
+	k := &KubernetesScheduler{}
+	k.fillRunningPodInfo(task, &mesos.TaskStatus{Data: data})
+
+	assert.Equal(api.PodRunning, task.Pod.Status.Phase)
+	assert.Equal("10.2.0.3", task.Pod.Status.PodIP)
+	assert.Equal("10.0.0.1", task.Pod.Status.HostIP)
+	web, found := task.Pod.Status.Info["web"]
+	assert.True(found)
+	assert.Equal(2, web.RestartCount)
+	assert.Equal("nginx", web.Image)
+	assert.NotNil(web.State.Running)
+}
+
+func TestFillRunningPodInfo_UnsupportedVersion(t *testing.T) {
+	assert := assert.New(t)
+	data, err := json.Marshal(&messages.PodStatus{Version: messages.StatusVersion + 1, PodIP: "10.2.0.3"})
+	assert.Nil(err)
+
+	task := &PodTask{ID: "bar", Pod: &api.Pod{}, podKey: "/pods/default/foo"}
+	k := &KubernetesScheduler{}
+	k.fillRunningPodInfo(task, &mesos.TaskStatus{Data: data})
+
+	assert.Equal(api.PodRunning, task.Pod.Status.Phase)
+	assert.Equal("", task.Pod.Status.PodIP)
+}
+
+func TestUnmapPodTask_OtherTask(t *testing.T) {
+	assert := assert.New(t)
+	k := &KubernetesScheduler{podToTask: map[string]string{"/pods/default/foo": "baz"}}
+
+	k.unmapPodTask(&PodTask{ID: "bar", podKey: "/pods/default/foo"})
+	assert.Equal("baz", k.podToTask["/pods/default/foo"])
+
+	k.unmapPodTask(&PodTask{ID: "baz", podKey: "/pods/default/foo"})
+	_, found := k.podToTask["/pods/default/foo"]
+	assert.False(found)
+}
+
+func TestHandleUsageReport(t *testing.T) {
+	assert := assert.New(t)
+	task := &PodTask{ID: "bar", Pod: &api.Pod{}, TaskInfo: newTaskInfo("PodTask"), podKey: "/pods/default/foo"}
+	task.TaskInfo.Resources = []*mesos.Resource{
+		mesos.ScalarResource("cpus", containerCpus),
+		mesos.ScalarResource("mem", containerMem),
+	}
+	k := &KubernetesScheduler{
+		pendingTasks:  map[string]*PodTask{},
+		runningTasks:  map[string]*PodTask{"bar": task},
+		finishedTasks: ring.New(defaultFinishedTasksSize),
+	}
+
+	k.handleUsageReport(&messages.UsageReport{Tasks: []messages.TaskUsage{
+		{TaskID: "bar", PodUsage: messages.PodUsage{Usage: messages.ResourceUsage{Cpus: 0.5, MemoryUsage: 32 * bytesPerMB}}},
+		{TaskID: "unknown"},
+	}})
+
+	assert.NotNil(task.Usage)
+	assert.Equal(0.5, task.Usage.Cpus)
+	cpus, mem := task.allocatedResources()
+	assert.Equal(containerCpus, cpus)
+	assert.Equal(float64(containerMem), mem)
+	assert.True(exceedsAllocation(task.Usage, cpus, mem))
+}
+
+func TestSlavePayloadFormat(t *testing.T) {
+	assert := assert.New(t)
+	slave := newSlave("host1")
+
+	// executor hasn't advertised anything yet, and may predate the envelope
+	_, encoding := slave.payloadFormat()
+	assert.Equal(messages.EncodingLegacyYAML, encoding)
+
+	slave.capabilities = &messages.ExecutorCapabilities{
+		ApiVersions: []string{messages.DefaultApiVersion, "v0"},
+		Encodings:   []string{messages.EncodingJSON, messages.EncodingProtobuf},
+	}
+	version, encoding := slave.payloadFormat()
+	assert.Equal(messages.DefaultApiVersion, version)
+	assert.Equal(messages.EncodingProtobuf, encoding)
+
+	// capabilities are forgotten when the executor or slave is lost
+	k := New(&mesos.ExecutorInfo{ExecutorId: &mesos.ExecutorID{Value: proto.String("executor")}}, nil, nil)
+	k.slaves["s1"] = slave
+	slaveId := &mesos.SlaveID{Value: proto.String("s1")}
+	caps, _ := messages.EncodeFrameworkMessage(messages.CapabilitiesKind, messages.LocalCapabilities())
+
+	// an older executor replaces the one that advertised its capabilities
+	k.ExecutorLost(nil, nil, slaveId, 1)
+	_, encoding = slave.payloadFormat()
+	assert.Equal(messages.EncodingLegacyYAML, encoding)
+
+	k.FrameworkMessage(nil, nil, slaveId, caps)
+	_, encoding = slave.payloadFormat()
+	assert.NotEqual(messages.EncodingLegacyYAML, encoding)
+
+	// the slave comes back with an older executor
+	k.SlaveLost(nil, slaveId)
+	_, encoding = slave.payloadFormat()
+	assert.Equal(messages.EncodingLegacyYAML, encoding)
+}
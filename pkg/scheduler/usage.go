@@ -0,0 +1,97 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	log "github.com/golang/glog"
+	"github.com/mesos/mesos-go/mesos"
+	"github.com/mesosphere/kubernetes-mesos/pkg/executor/messages"
+)
+
+// podUsage is the JSON representation of a running pod's resource usage
+type podUsage struct {
+	messages.TaskUsage
+	Cpus     float64 `json:"cpus"`     // cpus allocated to the task
+	Mem      float64 `json:"mem"`      // MB of memory allocated to the task
+	Exceeded bool    `json:"exceeded"` // true if usage exceeds the task's allocation
+}
+
+// records the usage reported by an executor against its running tasks.
+// assume that the caller has already locked around access to task state
+func (k *KubernetesScheduler) handleUsageReport(report *messages.UsageReport) {
+	for _, tu := range report.Tasks {
+		task, state := k.getTask(tu.TaskID)
+		if state != stateRunning {
+			log.V(2).Infof("Ignoring usage report for task %v that is not running", tu.TaskID)
+			continue
+		}
+		usage := tu.Usage
+		task.Usage = &usage
+		if cpus, mem := task.allocatedResources(); exceedsAllocation(&usage, cpus, mem) {
+			log.Warningf("Pod %s (task %v) exceeds its allocation of %.2f cpus / %.0f MB: using %.2f cpus / %.0f MB",
+				task.podKey, task.ID, cpus, mem, usage.Cpus, float64(usage.MemoryUsage)/bytesPerMB)
+		}
+	}
+}
+
+// returns the cpus and MB of memory allocated to the task
+func (t *PodTask) allocatedResources() (cpus, mem float64) {
+	if t.TaskInfo == nil {
+		return
+	}
+	for _, r := range t.TaskInfo.Resources {
+		if r.GetType() != mesos.Value_SCALAR {
+			continue
+		}
+		switch r.GetName() {
+		case "cpus":
+			cpus += r.GetScalar().GetValue()
+		case "mem":
+			mem += r.GetScalar().GetValue()
+		}
+	}
+	return
+}
+
+func exceedsAllocation(usage *messages.ResourceUsage, cpus, mem float64) bool {
+	return (cpus > 0 && usage.Cpus > cpus) || (mem > 0 && float64(usage.MemoryUsage)/bytesPerMB > mem)
+}
+
+// UsageHandler returns an http.Handler that serves the most recently reported
+// resource usage of every running pod.
+func (k *KubernetesScheduler) UsageHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		k.RLock()
+		result := []podUsage{}
+		for _, task := range k.runningTasks {
+			if task.Usage == nil {
+				continue
+			}
+			cpus, mem := task.allocatedResources()
+			result = append(result, podUsage{
+				TaskUsage: messages.TaskUsage{
+					TaskID: task.ID,
+					PodUsage: messages.PodUsage{
+						Namespace: task.Pod.Namespace,
+						Name:      task.Pod.Name,
+						UID:       task.Pod.UID,
+						Usage:     *task.Usage,
+					},
+				},
+				Cpus:     cpus,
+				Mem:      mem,
+				Exceeded: exceedsAllocation(task.Usage, cpus, mem),
+			})
+		}
+		k.RUnlock()
+
+		data, err := json.Marshal(result)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Add("Content-type", "application/json")
+		w.Write(data)
+	})
+}